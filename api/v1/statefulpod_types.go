@@ -37,6 +37,167 @@ type StatefulPodSpec struct {
 	PodTemplate     corev1.PodSpec                       `json:"podTemplate"`
 	PVCTemplate     *corev1.PersistentVolumeClaimSpec    `json:"pvcTemplate,omitempty"`
 	PVNames         []string                             `json:"pvNames,omitempty"`
+	// 添加到成员 pod 上的 label 和 annotation，label 不覆盖 selector 与 service selector 中的 label
+	PodMetadata *PodMetadata `json:"podMetadata,omitempty"`
+	// 强制删除失联 node 上的成员前执行的隔离步骤，不设置则不做隔离
+	Fencing *FencingPolicy `json:"fencing,omitempty"`
+	// node 失联替换成员时 pvc 的处理方式，默认 Delete
+	// +kubebuilder:validation:Enum=Delete;Reattach;SnapshotThenRecreate
+	FailoverVolumePolicy FailoverVolumePolicy `json:"failoverVolumePolicy,omitempty"`
+	// 创建 VolumeSnapshot 时使用的 VolumeSnapshotClass，不设置则使用默认的 VolumeSnapshotClass
+	VolumeSnapshotClassName *string `json:"volumeSnapshotClassName,omitempty"`
+	// node 失联或创建超时替换成员时，旧 pvc 绑定的 pv 的隔离策略，默认隔离
+	QuarantinePolicy *QuarantinePolicy `json:"quarantinePolicy,omitempty"`
+	// 定时为成员 pvc 创建 VolumeSnapshot 备份
+	BackupPolicy *BackupPolicy `json:"backupPolicy,omitempty"`
+	// 创建成员 pvc 时使用的数据源，用于从备份恢复
+	RestoreFrom *RestoreSource `json:"restoreFrom,omitempty"`
+	// 扩容时新成员的 pvc 从已有成员的数据播种，不设置则创建空的 pvc
+	SeedPolicy *SeedPolicy `json:"seedPolicy,omitempty"`
+	// node 失联替换成员且 failoverVolumePolicy 为 Delete 时替代 pvc 的数据来源，默认 None
+	// +kubebuilder:validation:Enum=None;LatestSnapshot;HealthyPeer
+	RecoveryPolicy RecoveryPolicy `json:"recoveryPolicy,omitempty"`
+	// 从同名的 StatefulSet 迁移，逐个成员接管 StatefulSet 的 pod 并复用其 pvc
+	MigrateFrom *MigrationSource `json:"migrateFrom,omitempty"`
+	// 暂停后控制器不再创建、删除、替换成员，只更新状态
+	Paused bool `json:"paused,omitempty"`
+}
+
+const (
+	// 带有该 annotation 的成员 pod 不等待 node 失联超时，立即替换该成员
+	// 只替换该成员，不隔离其所在的 node，避免影响 node 上的其他 pod
+	ForceFailoverAnnotation = "iapetos.foundary-cloud.io/force-failover"
+	// 修改 statefulPod 的该 annotation 后按序号逐个重建成员 pod，pvc 保留
+	RestartedAtAnnotation = "iapetos.foundary-cloud.io/restartedAt"
+)
+
+// 成员 pod 的 metadata
+type PodMetadata struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// 迁移来源
+type MigrationSource struct {
+	// 同一 namespace 下的 StatefulSet，名称必须与 statefulPod 相同
+	StatefulSetName string `json:"statefulSetName"`
+}
+
+type MigrationPhase string
+
+const (
+	MigrationInProgress MigrationPhase = "InProgress"
+	MigrationCompleted  MigrationPhase = "Completed"
+	MigrationFailed     MigrationPhase = "Failed"
+)
+
+// 迁移进度
+type MigrationStatus struct {
+	StatefulSetName string         `json:"statefulSetName"`
+	Phase           MigrationPhase `json:"phase"`
+	Message         string         `json:"message,omitempty"`
+	StartTime       *metav1.Time   `json:"startTime,omitempty"`
+	CompletionTime  *metav1.Time   `json:"completionTime,omitempty"`
+}
+
+type SeedMode string
+
+const (
+	// 直接克隆 peer 的 pvc，需要 CSI 支持 volume clone
+	SeedModeClone SeedMode = "Clone"
+	// 为 peer 的 pvc 创建快照，从快照恢复新成员的 pvc
+	SeedModeSnapshot SeedMode = "Snapshot"
+)
+
+// 新成员 pvc 的播种策略
+type SeedPolicy struct {
+	// +kubebuilder:validation:Enum=Clone;Snapshot
+	Mode SeedMode `json:"mode"`
+	// 作为数据来源的成员 index，默认 0，只对 index 更大的新成员生效
+	// +kubebuilder:validation:Minimum=0
+	PeerIndex *int32 `json:"peerIndex,omitempty"`
+}
+
+// 成员 pvc 的恢复来源，只在创建 pvc 时生效
+type RestoreSource struct {
+	// 从同一 namespace 下的 StatefulPodBackup 恢复，每个成员使用备份中相同 index 的快照
+	// 备份完成前不会创建成员，备份中不存在的 index 创建空的 pvc
+	BackupName string `json:"backupName,omitempty"`
+	// 按 index 指定数据源，可以是 VolumeSnapshot 或 PersistentVolumeClaim，优先于 backupName
+	DataSources []corev1.TypedLocalObjectReference `json:"dataSources,omitempty"`
+}
+
+// 定时备份策略，每次备份生成一个 StatefulPodBackup
+// 备份不随 statefulPod 删除，只有超出保留数量的定时备份会被清理
+type BackupPolicy struct {
+	// cron 格式的备份时间，如 "0 2 * * *"
+	Schedule string `json:"schedule"`
+	// 保留的备份数量，默认 3
+	// +kubebuilder:validation:Minimum=1
+	Retention *int32 `json:"retention,omitempty"`
+	// 备份使用的 VolumeSnapshotClass，不设置则使用 spec.volumeSnapshotClassName
+	VolumeSnapshotClassName *string `json:"volumeSnapshotClassName,omitempty"`
+	// 成员快照的创建方式，默认 Ordered
+	// +kubebuilder:validation:Enum=Ordered;Simultaneous
+	Mode BackupMode `json:"mode,omitempty"`
+}
+
+// 隔离的 pv 不会被删除，保留数据用于误判 failover 后的恢复
+// 替代成员沿用原 pvc 的名称，原 pvc 对象会被删除，数据保留在隔离的 pv 上；
+// 删除 statefulPod 时隔离的 pv 保持 Retain，需要手动清理
+type QuarantinePolicy struct {
+	// 为 true 时不做隔离，直接按 pv 原有的回收策略处理
+	Disabled bool `json:"disabled,omitempty"`
+	// 隔离 pv 的保留时间（秒），超时后恢复 pv 原有的回收策略，默认 86400
+	// +kubebuilder:validation:Minimum=0
+	TTLSeconds *int64 `json:"ttlSeconds,omitempty"`
+}
+
+// 成员状态变化的原因
+const (
+	ReasonNodeLost         = "NodeLost"
+	ReasonForcedFailover   = "ForcedFailover"
+	ReasonCreateTimeout    = "CreateTimeout"
+	ReasonUnschedulable    = "Unschedulable"
+	ReasonImagePullBackOff = "ImagePullBackOff"
+	ReasonPodNotFound      = "PodNotFound"
+	ReasonPodTerminating   = "PodTerminating"
+	ReasonRollingRestart   = "RollingRestart"
+	ReasonMigration        = "Migration"
+	ReasonPVCTerminating   = "PVCTerminating"
+)
+
+type FailoverVolumePolicy string
+
+const (
+	// 删除 pvc，替代成员使用新建的空 pvc，适用于 node 本地存储
+	FailoverVolumeDelete FailoverVolumePolicy = "Delete"
+	// 保留 pvc，只重建 pod，由新 node 重新挂载，适用于网络块存储
+	FailoverVolumeReattach FailoverVolumePolicy = "Reattach"
+	// 先为 pvc 创建 VolumeSnapshot，再删除 pvc，替代成员的 pvc 从快照恢复
+	FailoverVolumeSnapshotThenRecreate FailoverVolumePolicy = "SnapshotThenRecreate"
+)
+
+type RecoveryPolicy string
+
+const (
+	// 替代 pvc 为空
+	RecoveryNone RecoveryPolicy = "None"
+	// 从最近一次完成的备份中该成员的快照恢复
+	RecoveryLatestSnapshot RecoveryPolicy = "LatestSnapshot"
+	// 克隆一个健康成员的 pvc
+	RecoveryHealthyPeer RecoveryPolicy = "HealthyPeer"
+)
+
+// node 隔离策略，隔离确认且启用的步骤全部完成后才会创建替代成员
+// 隔离由 provider 确认；未配置 provider 时，需要管理员确认 node 已停止运行后为其添加 node.kubernetes.io/out-of-service 污点
+type FencingPolicy struct {
+	// provider 确认隔离后为 node 添加 node.kubernetes.io/out-of-service:NoExecute 污点，node 恢复 Ready 后移除
+	Taint bool `json:"taint,omitempty"`
+	// 删除成员 pv 在失联 node 上的 VolumeAttachment
+	DeleteVolumeAttachments bool `json:"deleteVolumeAttachments,omitempty"`
+	// 使用已注册的隔离 provider 隔离 node，如通过 IPMI 断电
+	Provider string `json:"provider,omitempty"`
 }
 
 // StatefulPodStatus defines the observed state of StatefulPod
@@ -45,6 +206,40 @@ type StatefulPodStatus struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	PodStatusMes []PodStatus `json:"podStatus,omitempty"`
 	PVCStatusMes []PVCStatus `json:"pvcStatus,omitempty"`
+	// 替换成员时被隔离的 pv
+	QuarantinedVolumes []QuarantinedVolume `json:"quarantinedVolumes,omitempty"`
+	// 最近一次定时备份的时间
+	LastBackupTime *metav1.Time `json:"lastBackupTime,omitempty"`
+	// 从 StatefulSet 迁移的进度
+	Migration *MigrationStatus `json:"migration,omitempty"`
+	// 最近一次完成的滚动重启，与 restartedAt annotation 的值一致时重启完成
+	RestartedAt string `json:"restartedAt,omitempty"`
+	// 无法自动恢复的错误，如 spec 不合法
+	Conditions []StatefulPodCondition `json:"conditions,omitempty"`
+}
+
+type StatefulPodConditionType string
+
+const (
+	// spec 不合法，修改 spec 前不再重试
+	StatefulPodInvalidSpec StatefulPodConditionType = "InvalidSpec"
+)
+
+type StatefulPodCondition struct {
+	Type               StatefulPodConditionType `json:"type"`
+	Status             corev1.ConditionStatus   `json:"status"`
+	Reason             string                   `json:"reason,omitempty"`
+	Message            string                   `json:"message,omitempty"`
+	LastTransitionTime metav1.Time              `json:"lastTransitionTime,omitempty"`
+}
+
+// 被隔离的 pv
+type QuarantinedVolume struct {
+	Index         *int32      `json:"index"`
+	PVCName       string      `json:"pvcName"`
+	PVName        string      `json:"pvName"`
+	Reason        string      `json:"reason"`
+	QuarantinedAt metav1.Time `json:"quarantinedAt"`
 }
 
 // pod 状态
@@ -53,6 +248,16 @@ type PodStatus struct {
 	Status   corev1.PodPhase `json:"status"`
 	Index    *int32          `json:"index"`
 	NodeName string          `json:"nodeName"`
+	// pod 是否就绪
+	Ready bool `json:"ready,omitempty"`
+	// pod 所有容器的重启次数之和
+	RestartCount int32 `json:"restartCount,omitempty"`
+	// 进入当前状态的原因，如 NodeLost、CreateTimeout、Unschedulable、ImagePullBackOff
+	Reason string `json:"reason,omitempty"`
+	// 进入当前状态原因的说明
+	Message string `json:"message,omitempty"`
+	// 最近一次状态变化的时间
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
 }
 
 // pvc 状态
@@ -64,6 +269,16 @@ type PVCStatus struct {
 	AccessModes  []corev1.PersistentVolumeAccessMode `json:"accessModes"`
 	StorageClass string                              `json:"storageClass"`
 	PVName       string                              `json:"pvName"`
+	// 创建 pvc 时使用的数据源
+	DataSource *corev1.TypedLocalObjectReference `json:"dataSource,omitempty"`
+	// 播种使用的 peer pvc 名称以及播种时间
+	SeededFrom string       `json:"seededFrom,omitempty"`
+	SeededAt   *metav1.Time `json:"seededAt,omitempty"`
+	// 进入当前状态的原因以及说明
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	// 最近一次状态变化的时间
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -0,0 +1,93 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type BackupMode string
+
+const (
+	// 按 index 依次创建成员快照，前一个快照可用后再创建下一个
+	BackupModeOrdered BackupMode = "Ordered"
+	// 同时创建所有成员的快照
+	BackupModeSimultaneous BackupMode = "Simultaneous"
+)
+
+type BackupPhase string
+
+const (
+	BackupPending    BackupPhase = "Pending"
+	BackupInProgress BackupPhase = "InProgress"
+	BackupCompleted  BackupPhase = "Completed"
+	BackupFailed     BackupPhase = "Failed"
+)
+
+// StatefulPodBackupSpec defines the desired state of StatefulPodBackup
+type StatefulPodBackupSpec struct {
+	// 备份的 statefulPod，与 backup 位于同一 namespace
+	StatefulPodName string `json:"statefulPodName"`
+	// 不设置则使用 statefulPod 的 spec.volumeSnapshotClassName
+	VolumeSnapshotClassName *string `json:"volumeSnapshotClassName,omitempty"`
+	// +kubebuilder:validation:Enum=Ordered;Simultaneous
+	Mode BackupMode `json:"mode,omitempty"`
+}
+
+// StatefulPodBackupStatus defines the observed state of StatefulPodBackup
+type StatefulPodBackupStatus struct {
+	Phase          BackupPhase      `json:"phase,omitempty"`
+	StartTime      *metav1.Time     `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time     `json:"completionTime,omitempty"`
+	Message        string           `json:"message,omitempty"`
+	Snapshots      []MemberSnapshot `json:"snapshots,omitempty"`
+}
+
+// 成员 pvc 的快照
+type MemberSnapshot struct {
+	Index        *int32 `json:"index"`
+	PVCName      string `json:"pvcName"`
+	SnapshotName string `json:"snapshotName,omitempty"`
+	ReadyToUse   bool   `json:"readyToUse"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="StatefulPod",type="string",JSONPath=".spec.statefulPodName"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// StatefulPodBackup is the Schema for the statefulpodbackups API
+type StatefulPodBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   StatefulPodBackupSpec   `json:"spec,omitempty"`
+	Status StatefulPodBackupStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// StatefulPodBackupList contains a list of StatefulPodBackup
+type StatefulPodBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []StatefulPodBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&StatefulPodBackup{}, &StatefulPodBackupList{})
+}
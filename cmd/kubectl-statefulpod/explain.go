@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+// 控制器记录的成员状态的含义
+var phaseExplanations = map[corev1.PodPhase]string{
+	"Preparing":     "the pod was created and is not running yet",
+	"CreateTimeOut": "the pod did not start in time, the member is being recreated",
+	"Deleting":      "the pod is gone and will be recreated by the controller",
+	"Fencing":       "the node is lost, waiting for the fencing provider or an out-of-service taint added by an admin to confirm it is down before the member is replaced",
+	"Migrating":     "the member is still managed by the statefulSet being migrated",
+}
+
+// 说明成员无法就绪的原因
+func runExplain(opts *options, args []string) error {
+	flags := pflag.NewFlagSet("explain", pflag.ExitOnError)
+	opts.addFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("a statefulPod name and an ordinal are required")
+	}
+	if err := opts.complete(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	statefulPod, err := opts.getStatefulPod(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	index, err := parseOrdinal(statefulPod, flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	if statefulPod.Spec.Paused {
+		fmt.Println("statefulPod is paused, the controller does not act on its members")
+	}
+	podStatus := statefulPod.Status.PodStatusMes[index]
+	fmt.Printf("Member %v: %v", index, podStatus.Status)
+	if explanation, ok := phaseExplanations[podStatus.Status]; ok {
+		fmt.Printf(" (%v)", explanation)
+	}
+	fmt.Println()
+	if podStatus.Reason != "" {
+		fmt.Printf("  reason: %v %v\n", podStatus.Reason, podStatus.Message)
+	}
+	if podStatus.LastTransitionTime != nil {
+		fmt.Printf("  since: %v\n", podStatus.LastTransitionTime)
+	}
+
+	var pod corev1.Pod
+	if err := opts.client.Get(ctx, types.NamespacedName{Namespace: statefulPod.Namespace, Name: podStatus.PodName}, &pod); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		fmt.Printf("Pod %v: not found\n", podStatus.PodName)
+	} else {
+		explainPod(&pod)
+		opts.explainNode(ctx, pod.Spec.NodeName)
+		opts.explainEvents(ctx, "Pod", pod.Name)
+	}
+
+	if index < len(statefulPod.Status.PVCStatusMes) && statefulPod.Spec.PVCTemplate != nil {
+		pvcStatus := statefulPod.Status.PVCStatusMes[index]
+		var pvc corev1.PersistentVolumeClaim
+		if err := opts.client.Get(ctx, types.NamespacedName{Namespace: statefulPod.Namespace, Name: pvcStatus.PVCName}, &pvc); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			fmt.Printf("PVC %v: not found\n", pvcStatus.PVCName)
+		} else {
+			fmt.Printf("PVC %v: %v", pvc.Name, pvc.Status.Phase)
+			if pvc.Spec.DataSource != nil {
+				fmt.Printf(", restoring from %v/%v", pvc.Spec.DataSource.Kind, pvc.Spec.DataSource.Name)
+			}
+			fmt.Println()
+			opts.explainEvents(ctx, "PersistentVolumeClaim", pvc.Name)
+		}
+	}
+	for _, volume := range statefulPod.Status.QuarantinedVolumes {
+		if volume.Index != nil && int(*volume.Index) == index {
+			fmt.Printf("Quarantined PV %v (%v) since %v\n", volume.PVName, volume.Reason, volume.QuarantinedAt)
+		}
+	}
+	return nil
+}
+
+func explainPod(pod *corev1.Pod) {
+	fmt.Printf("Pod %v: %v on node %v\n", pod.Name, pod.Status.Phase, valueOrNone(pod.Spec.NodeName))
+	if !pod.DeletionTimestamp.IsZero() {
+		fmt.Printf("  terminating since %v\n", pod.DeletionTimestamp)
+	}
+	if value, ok := pod.Annotations[iapetosapiv1.ForceFailoverAnnotation]; ok {
+		fmt.Printf("  failover requested at %v\n", value)
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			fmt.Printf("  %v is %v: %v %v\n", condition.Type, condition.Status, condition.Reason, condition.Message)
+		}
+	}
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if waiting := status.State.Waiting; waiting != nil {
+			fmt.Printf("  container %v waiting: %v %v\n", status.Name, waiting.Reason, waiting.Message)
+		}
+		if terminated := status.LastTerminationState.Terminated; terminated != nil && status.RestartCount > 0 {
+			fmt.Printf("  container %v restarted %v times, last exit: %v (code %v)\n", status.Name, status.RestartCount, terminated.Reason, terminated.ExitCode)
+		}
+	}
+}
+
+func (o *options) explainNode(ctx context.Context, nodeName string) {
+	if nodeName == "" {
+		return
+	}
+	var node corev1.Node
+	if err := o.client.Get(ctx, types.NamespacedName{Name: nodeName}, &node); err != nil {
+		fmt.Printf("Node %v: %v\n", nodeName, err)
+		return
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady && condition.Status != corev1.ConditionTrue {
+			fmt.Printf("Node %v: not ready since %v: %v\n", nodeName, condition.LastTransitionTime, condition.Message)
+		}
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == corev1.TaintEffectNoExecute {
+			fmt.Printf("Node %v: tainted %v:%v\n", nodeName, taint.Key, taint.Effect)
+		}
+	}
+}
+
+// 输出对象最近的 Warning 事件
+func (o *options) explainEvents(ctx context.Context, kind, name string) {
+	var events corev1.EventList
+	if err := o.client.List(ctx, &events, client.InNamespace(o.namespace), client.MatchingFields{
+		"involvedObject.kind": kind,
+		"involvedObject.name": name,
+		"type":                corev1.EventTypeWarning,
+	}); err != nil {
+		return
+	}
+	sort.Slice(events.Items, func(i, j int) bool {
+		return events.Items[i].LastTimestamp.Before(&events.Items[j].LastTimestamp)
+	})
+	if len(events.Items) > 5 {
+		events.Items = events.Items[len(events.Items)-5:]
+	}
+	for _, event := range events.Items {
+		fmt.Printf("  %v: %v\n", event.Reason, event.Message)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+// 为成员 pod 添加 force-failover annotation，控制器立即替换该成员
+// 手动 failover 不隔离 node，需要确认原 pod 已停止写入数据
+func runFailover(opts *options, args []string) error {
+	flags := pflag.NewFlagSet("failover", pflag.ExitOnError)
+	opts.addFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("a statefulPod name and an ordinal are required")
+	}
+	if err := opts.complete(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	statefulPod, err := opts.getStatefulPod(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	index, err := parseOrdinal(statefulPod, flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	var pod corev1.Pod
+	if err := opts.client.Get(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      statefulPod.Status.PodStatusMes[index].PodName,
+	}, &pod); err != nil {
+		return err
+	}
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[iapetosapiv1.ForceFailoverAnnotation] = time.Now().Format(time.RFC3339)
+	if err := opts.client.Patch(ctx, &pod, patch); err != nil {
+		return err
+	}
+	fmt.Printf("failover of pod/%v requested, node %v is not fenced\n", pod.Name, pod.Spec.NodeName)
+	return nil
+}
+
+// 设置 restartedAt annotation，由控制器按序号逐个重建成员，等待重启完成
+func runRestart(opts *options, args []string) error {
+	flags := pflag.NewFlagSet("restart", pflag.ExitOnError)
+	opts.addFlags(flags)
+	timeout := flags.Duration("timeout", time.Minute*10, "time to wait for the restart to complete, 0 to not wait")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("exactly one statefulPod name is required")
+	}
+	if err := opts.complete(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	statefulPod, err := opts.getStatefulPod(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(statefulPod.DeepCopy())
+	if statefulPod.Annotations == nil {
+		statefulPod.Annotations = map[string]string{}
+	}
+	restartedAt := time.Now().Format(time.RFC3339)
+	statefulPod.Annotations[iapetosapiv1.RestartedAtAnnotation] = restartedAt
+	if err := opts.client.Patch(ctx, statefulPod, patch); err != nil {
+		return err
+	}
+	fmt.Printf("statefulpod/%v restarting\n", statefulPod.Name)
+	if *timeout == 0 {
+		return nil
+	}
+	if err := wait.PollImmediate(time.Second*2, *timeout, func() (bool, error) {
+		current, err := opts.getStatefulPod(ctx, statefulPod.Name)
+		if err != nil {
+			return false, err
+		}
+		return current.Status.RestartedAt == restartedAt, nil
+	}); err != nil {
+		return fmt.Errorf("statefulpod/%v did not finish restarting: %v", statefulPod.Name, err)
+	}
+	fmt.Printf("statefulpod/%v restarted\n", statefulPod.Name)
+	return nil
+}
+
+func parseOrdinal(statefulPod *iapetosapiv1.StatefulPod, value string) (int, error) {
+	index, err := strconv.Atoi(value)
+	if err != nil || index < 0 || index >= len(statefulPod.Status.PodStatusMes) {
+		return 0, fmt.Errorf("invalid ordinal %q, statefulpod/%v has %v members", value, statefulPod.Name, len(statefulPod.Status.PodStatusMes))
+	}
+	return index, nil
+}
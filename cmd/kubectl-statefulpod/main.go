@@ -0,0 +1,130 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl 插件，放到 PATH 中后通过 kubectl statefulpod <command> 使用
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+type command struct {
+	usage string
+	run   func(opts *options, args []string) error
+}
+
+var commands = map[string]command{
+	"status":   {"status NAME", runStatus},
+	"scale":    {"scale NAME SIZE", runScale},
+	"restart":  {"restart NAME [--timeout=10m]", runRestart},
+	"failover": {"failover NAME ORDINAL", runFailover},
+	"pause":    {"pause NAME", runPause(true)},
+	"resume":   {"resume NAME", runPause(false)},
+	"explain":  {"explain NAME ORDINAL", runExplain},
+	"migrate":  {"migrate STATEFULSET [--dry-run]", runMigrate},
+}
+
+// 按固定顺序输出帮助
+var commandOrder = []string{"status", "scale", "restart", "failover", "pause", "resume", "explain", "migrate"}
+
+// 所有子命令共用的参数
+type options struct {
+	kubeconfig string
+	namespace  string
+	client     client.Client
+}
+
+func (o *options) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.kubeconfig, "kubeconfig", "", "path to the kubeconfig file")
+	flags.StringVarP(&o.namespace, "namespace", "n", "", "namespace of the object, defaults to the namespace of the current context")
+}
+
+// 全局参数可以写在子命令之前，返回子命令名称以及去掉子命令后的参数，由子命令统一解析
+func splitCommand(args []string) (string, []string) {
+	global := pflag.NewFlagSet("global", pflag.ContinueOnError)
+	(&options{}).addFlags(global)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			return arg, append(append([]string{}, args[:i]...), args[i+1:]...)
+		}
+		if strings.Contains(arg, "=") {
+			continue
+		}
+		// 不带 = 的全局参数，下一个参数是其取值
+		var f *pflag.Flag
+		if strings.HasPrefix(arg, "--") {
+			f = global.Lookup(arg[2:])
+		} else if len(arg) == 2 {
+			f = global.ShorthandLookup(arg[1:])
+		}
+		if f != nil && f.NoOptDefVal == "" {
+			i++
+		}
+	}
+	return "", args
+}
+
+func (o *options) complete() error {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = iapetosapiv1.AddToScheme(scheme)
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+	if o.namespace == "" {
+		if o.namespace, _, err = clientConfig.Namespace(); err != nil {
+			return err
+		}
+	}
+	o.client, err = client.New(restConfig, client.Options{Scheme: scheme})
+	return err
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: kubectl statefulpod [flags] <command> [flags]")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, name := range commandOrder {
+		fmt.Fprintf(os.Stderr, "  %v\n", commands[name].usage)
+	}
+}
+
+func main() {
+	name, args := splitCommand(os.Args[1:])
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(&options{}, args); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
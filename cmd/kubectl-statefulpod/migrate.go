@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/pflag"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+
+	"github.com/q8s-io/iapetos/services/migration"
+)
+
+// 根据 StatefulSet 创建同名的 statefulPod，由控制器逐个接管 StatefulSet 的成员
+func runMigrate(opts *options, args []string) error {
+	flags := pflag.NewFlagSet("migrate", pflag.ExitOnError)
+	opts.addFlags(flags)
+	dryRun := flags.Bool("dry-run", false, "only print the statefulPod that would be created")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("exactly one statefulSet name is required")
+	}
+	if err := opts.complete(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	var statefulSet appsv1.StatefulSet
+	if err := opts.client.Get(ctx, types.NamespacedName{
+		Namespace: opts.namespace,
+		Name:      flags.Arg(0),
+	}, &statefulSet); err != nil {
+		return err
+	}
+	statefulPod, err := migration.FromStatefulSet(&statefulSet)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		out, err := yaml.Marshal(statefulPod)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+		return nil
+	}
+	if err := opts.client.Create(ctx, statefulPod); err != nil {
+		return err
+	}
+	fmt.Printf("statefulpod/%v created, migrating from statefulset/%v\n", statefulPod.Name, statefulSet.Name)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// 修改 spec.size
+func runScale(opts *options, args []string) error {
+	flags := pflag.NewFlagSet("scale", pflag.ExitOnError)
+	opts.addFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New("a statefulPod name and a size are required")
+	}
+	size, err := strconv.Atoi(flags.Arg(1))
+	if err != nil || size < 1 {
+		return fmt.Errorf("invalid size %q", flags.Arg(1))
+	}
+	if err := opts.complete(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	statefulPod, err := opts.getStatefulPod(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(statefulPod.DeepCopy())
+	replicas := int32(size)
+	statefulPod.Spec.Size = &replicas
+	if err := opts.client.Patch(ctx, statefulPod, patch); err != nil {
+		return err
+	}
+	fmt.Printf("statefulpod/%v scaled to %v\n", statefulPod.Name, size)
+	return nil
+}
+
+// 设置 spec.paused
+func runPause(paused bool) func(opts *options, args []string) error {
+	return func(opts *options, args []string) error {
+		flags := pflag.NewFlagSet("pause", pflag.ExitOnError)
+		opts.addFlags(flags)
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New("exactly one statefulPod name is required")
+		}
+		if err := opts.complete(); err != nil {
+			return err
+		}
+		ctx := context.Background()
+		statefulPod, err := opts.getStatefulPod(ctx, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		patch := client.MergeFrom(statefulPod.DeepCopy())
+		statefulPod.Spec.Paused = paused
+		if err := opts.client.Patch(ctx, statefulPod, patch); err != nil {
+			return err
+		}
+		if paused {
+			fmt.Printf("statefulpod/%v paused\n", statefulPod.Name)
+		} else {
+			fmt.Printf("statefulpod/%v resumed\n", statefulPod.Name)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+// 以表格展示成员的 pod、node、pvc、pv 以及就绪状态
+func runStatus(opts *options, args []string) error {
+	flags := pflag.NewFlagSet("status", pflag.ExitOnError)
+	opts.addFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("exactly one statefulPod name is required")
+	}
+	if err := opts.complete(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	statefulPod, err := opts.getStatefulPod(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Name:\t%v/%v\n", statefulPod.Namespace, statefulPod.Name)
+	fmt.Printf("Size:\t%v\n", *statefulPod.Spec.Size)
+	if statefulPod.Spec.Paused {
+		fmt.Println("Paused:\ttrue")
+	}
+	if restartedAt := statefulPod.Annotations[iapetosapiv1.RestartedAtAnnotation]; restartedAt != "" && restartedAt != statefulPod.Status.RestartedAt {
+		fmt.Printf("Restarting:\t%v\n", restartedAt)
+	}
+	if migration := statefulPod.Status.Migration; migration != nil {
+		fmt.Printf("Migration:\t%v from statefulset/%v %v\n", migration.Phase, migration.StatefulSetName, migration.Message)
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ORDINAL\tPOD\tPHASE\tREADY\tRESTARTS\tREASON\tNODE\tPVC\tPVC PHASE\tPV")
+	for i, podStatus := range statefulPod.Status.PodStatusMes {
+		pvcName, pvcPhase, pvName := "<none>", "", ""
+		if i < len(statefulPod.Status.PVCStatusMes) {
+			pvcStatus := statefulPod.Status.PVCStatusMes[i]
+			pvcName, pvcPhase, pvName = pvcStatus.PVCName, string(pvcStatus.Status), pvcStatus.PVName
+		}
+		ready := "false"
+		var pod corev1.Pod
+		if err := opts.client.Get(ctx, types.NamespacedName{
+			Namespace: statefulPod.Namespace,
+			Name:      podStatus.PodName,
+		}, &pod); err == nil && isPodReady(&pod) {
+			ready = "true"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", i, podStatus.PodName, podStatus.Status, ready,
+			podStatus.RestartCount, valueOrNone(podStatus.Reason), valueOrNone(podStatus.NodeName), pvcName, valueOrNone(pvcPhase), valueOrNone(pvName))
+	}
+	return w.Flush()
+}
+
+func (o *options) getStatefulPod(ctx context.Context, name string) (*iapetosapiv1.StatefulPod, error) {
+	var statefulPod iapetosapiv1.StatefulPod
+	if err := o.client.Get(ctx, types.NamespacedName{
+		Namespace: o.namespace,
+		Name:      name,
+	}, &statefulPod); err != nil {
+		return nil, err
+	}
+	return &statefulPod, nil
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
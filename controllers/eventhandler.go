@@ -1,92 +1,204 @@
 package controllers
 
 import (
+	"context"
+	"reflect"
+
 	"github.com/prometheus/common/log"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	"github.com/q8s-io/iapetos/services"
+	"github.com/q8s-io/iapetos/shard"
 )
 
-type StatefulPodEvent struct{}
+// 将 pod、pvc 的事件映射到所属的 statefulPod：有 controller ownerReference 时映射到 controller，
+// 孤儿对象映射到会认领它的 statefulPod
+type ChildMapper struct {
+	client.Client
+}
 
-func (s StatefulPodEvent) Create(event event.CreateEvent, q workqueue.RateLimitingInterface) {
-	if event.Meta == nil {
-		log.Error(nil, "CreateEvent received with no metadata", "event", event)
-		return
+func (m ChildMapper) Map(obj handler.MapObject) []reconcile.Request {
+	if name, ok := controllerStatefulPod(obj.Meta); ok {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{
+			Namespace: obj.Meta.GetNamespace(),
+			Name:      name,
+		}}}
 	}
-	if pod, ok := event.Object.(*corev1.Pod); ok {
-		if _, ok := pod.Annotations[iapetosapiv1.GroupVersion.String()]; ok {
-			q.Add(reconcile.Request{NamespacedName: types.NamespacedName{
-				Namespace: pod.Namespace,
-				Name:      pod.Name,
-			}})
-			return
-		}
+	if metav1.GetControllerOf(obj.Meta) != nil || !obj.Meta.GetDeletionTimestamp().IsZero() {
+		return nil
+	}
+	// 只查找成员名称前缀与孤儿对象一致的 statefulPod
+	prefix, ok := services.MemberPrefix(obj.Meta.GetName())
+	if !ok {
+		return nil
 	}
-	if pvc, ok := event.Object.(*corev1.PersistentVolumeClaim); ok {
-		if _, ok := pvc.Annotations[iapetosapiv1.GroupVersion.String()]; ok {
-			q.Add(reconcile.Request{NamespacedName: types.NamespacedName{
-				Namespace: pvc.Namespace,
-				Name:      pvc.Name,
+	var statefulPodList iapetosapiv1.StatefulPodList
+	if err := m.List(context.Background(), &statefulPodList, client.InNamespace(obj.Meta.GetNamespace()),
+		client.MatchingFields{services.MemberPrefixField: prefix}); err != nil {
+		log.Error(err, "list statefulPod error", "namespace", obj.Meta.GetNamespace())
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range statefulPodList.Items {
+		statefulPod := &statefulPodList.Items[i]
+		// spec 不合法的 statefulPod 不会认领对象，匹配时也可能因缺少字段出错
+		if services.ValidateStatefulPod(statefulPod) != nil {
+			continue
+		}
+		refManager, err := services.NewRefManager(m.Client, nil, statefulPod)
+		if err != nil {
+			continue
+		}
+		var match bool
+		switch child := obj.Object.(type) {
+		case *corev1.Pod:
+			_, match = refManager.MatchPod(child)
+		case *corev1.PersistentVolumeClaim:
+			_, match = refManager.MatchPVC(child)
+		}
+		if match {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: statefulPod.Namespace,
+				Name:      statefulPod.Name,
 			}})
-			return
 		}
 	}
+	return requests
+}
+
+// controller 为 statefulPod 时返回其名称
+func controllerStatefulPod(meta metav1.Object) (string, bool) {
+	controllerRef := metav1.GetControllerOf(meta)
+	if controllerRef == nil || controllerRef.APIVersion != iapetosapiv1.GroupVersion.String() || controllerRef.Kind != services.StatefulPod {
+		return "", false
+	}
+	return controllerRef.Name, true
 }
 
-func (s StatefulPodEvent) Update(event event.UpdateEvent, q workqueue.RateLimitingInterface) {
-	if event.MetaNew == nil {
-		log.Error(nil, "CreateEvent received with no metadata", "event", event)
+// 以 pod 所在 node 建立索引，用于通过 node 查找其上的 pod
+const NodeNameField = "spec.nodeName"
+
+func IndexPodNodeName(obj runtime.Object) []string {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || pod.Spec.NodeName == "" {
+		return nil
+	}
+	return []string{pod.Spec.NodeName}
+}
+
+// node 健康状态变化时，将其上 pod 所属的 statefulPod 加入队列
+type NodeEvent struct {
+	client.Client
+}
+
+func (n NodeEvent) Create(event event.CreateEvent, q workqueue.RateLimitingInterface) {
+}
+
+func (n NodeEvent) Update(event event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	oldNode, ok := event.ObjectOld.(*corev1.Node)
+	if !ok {
 		return
 	}
-	if pod, ok := event.ObjectNew.(*corev1.Pod); ok {
-		if _, ok := pod.Annotations[iapetosapiv1.GroupVersion.String()]; ok {
-			q.Add(reconcile.Request{NamespacedName: types.NamespacedName{
-				Namespace: pod.Namespace,
-				Name:      pod.Name,
-			}})
-			return
-		}
+	newNode, ok := event.ObjectNew.(*corev1.Node)
+	if !ok {
+		return
 	}
-	if pvc, ok := event.ObjectNew.(*corev1.PersistentVolumeClaim); ok {
-		if _, ok := pvc.Annotations[iapetosapiv1.GroupVersion.String()]; ok {
-			q.Add(reconcile.Request{NamespacedName: types.NamespacedName{
-				Namespace: pvc.Namespace,
-				Name:      pvc.Name,
-			}})
-			return
-		}
+	if !isNodeHealthChanged(oldNode, newNode) {
+		return
 	}
+	n.enqueueStatefulPods(newNode.Name, q)
 }
 
-func (s StatefulPodEvent) Delete(event event.DeleteEvent, q workqueue.RateLimitingInterface) {
+func (n NodeEvent) Delete(event event.DeleteEvent, q workqueue.RateLimitingInterface) {
 	if event.Meta == nil {
-		log.Error(nil, "CreateEvent received with no metadata", "event", event)
+		log.Error(nil, "DeleteEvent received with no metadata", "event", event)
 		return
 	}
-	if pod, ok := event.Object.(*corev1.Pod); ok {
-		if _, ok := pod.Annotations[iapetosapiv1.GroupVersion.String()]; ok {
-			q.Add(reconcile.Request{NamespacedName: types.NamespacedName{
-				Namespace: pod.Namespace,
-				Name:      pod.Name,
-			}})
-			return
+	n.enqueueStatefulPods(event.Meta.GetName(), q)
+}
+
+func (n NodeEvent) Generic(event event.GenericEvent, q workqueue.RateLimitingInterface) {
+}
+
+func (n NodeEvent) enqueueStatefulPods(nodeName string, q workqueue.RateLimitingInterface) {
+	var podList corev1.PodList
+	if err := n.List(context.Background(), &podList, client.MatchingFields{NodeNameField: nodeName}); err != nil {
+		log.Error(err, "list pod by node error", "node", nodeName)
+		return
+	}
+	for i := range podList.Items {
+		name, ok := controllerStatefulPod(&podList.Items[i])
+		if !ok {
+			continue
 		}
+		q.Add(reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: podList.Items[i].Namespace,
+			Name:      name,
+		}})
 	}
-	if pvc, ok := event.Object.(*corev1.PersistentVolumeClaim); ok {
-		if _, ok := pvc.Annotations[iapetosapiv1.GroupVersion.String()]; ok {
-			q.Add(reconcile.Request{NamespacedName: types.NamespacedName{
-				Namespace: pvc.Namespace,
-				Name:      pvc.Name,
-			}})
-			return
+}
+
+// Ready condition 或 NoExecute 污点发生变化
+func isNodeHealthChanged(oldNode, newNode *corev1.Node) bool {
+	oldReady := services.GetNodeReadyCondition(oldNode)
+	newReady := services.GetNodeReadyCondition(newNode)
+	if (oldReady == nil) != (newReady == nil) {
+		return true
+	}
+	if oldReady != nil && oldReady.Status != newReady.Status {
+		return true
+	}
+	return !reflect.DeepEqual(noExecuteTaints(oldNode), noExecuteTaints(newNode))
+}
+
+func noExecuteTaints(node *corev1.Node) []corev1.Taint {
+	var taints []corev1.Taint
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == corev1.TaintEffectNoExecute {
+			taints = append(taints, taint)
 		}
 	}
+	return taints
+}
+
+// 配置重新加载后，将当前分片的所有 statefulPod 加入队列，使新的超时等配置立即生效
+type ConfigEvent struct {
+	client.Client
+	ShardSelector labels.Selector
+}
+
+func (c ConfigEvent) Create(event event.CreateEvent, q workqueue.RateLimitingInterface) {
+}
+
+func (c ConfigEvent) Update(event event.UpdateEvent, q workqueue.RateLimitingInterface) {
 }
 
-func (s StatefulPodEvent) Generic(event event.GenericEvent, q workqueue.RateLimitingInterface) {
+func (c ConfigEvent) Delete(event event.DeleteEvent, q workqueue.RateLimitingInterface) {
+}
+
+func (c ConfigEvent) Generic(event event.GenericEvent, q workqueue.RateLimitingInterface) {
+	var statefulPodList iapetosapiv1.StatefulPodList
+	if err := c.List(context.Background(), &statefulPodList); err != nil {
+		log.Error(err, "list statefulPod error")
+		return
+	}
+	for i := range statefulPodList.Items {
+		if !shard.Contains(c.ShardSelector, &statefulPodList.Items[i]) {
+			continue
+		}
+		q.Add(reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: statefulPodList.Items[i].Namespace,
+			Name:      statefulPodList.Items[i].Name,
+		}})
+	}
 }
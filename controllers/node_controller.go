@@ -0,0 +1,74 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/q8s-io/iapetos/services"
+	"github.com/q8s-io/iapetos/services/fencing"
+)
+
+// NodeReconciler 在被隔离的 node 恢复 Ready 后移除控制器添加的 out-of-service 污点
+// 分片部署时污点记录了添加它的分片，每个分片只处理自己添加的污点
+type NodeReconciler struct {
+	client.Client
+	Log logr.Logger
+}
+
+// nodes 的权限与 StatefulPodReconciler 共用
+func (r *NodeReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	var node corev1.Node
+	if err := r.Get(ctx, req.NamespacedName, &node); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if ready := services.GetNodeReadyCondition(&node); ready == nil || ready.Status != corev1.ConditionTrue {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, fencing.NewFencer(r.Client).Unfence(ctx, &node)
+}
+
+func (r *NodeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// 只处理带有控制器添加的污点的 node
+	fenced := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			node, ok := e.Object.(*corev1.Node)
+			return ok && fencing.IsFencedByController(node)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			node, ok := e.ObjectNew.(*corev1.Node)
+			return ok && fencing.IsFencedByController(node)
+		},
+		DeleteFunc: func(event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(event.GenericEvent) bool {
+			return false
+		},
+	}
+	return ctrl.NewControllerManagedBy(mgr).For(&corev1.Node{}).
+		WithEventFilter(fenced).
+		Complete(r)
+}
@@ -0,0 +1,224 @@
+package backup_controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	"github.com/q8s-io/iapetos/services"
+	backupservice "github.com/q8s-io/iapetos/services/backup"
+	"github.com/q8s-io/iapetos/services/snapshot"
+)
+
+const (
+	// 默认保留的备份数量
+	defaultRetention = 3
+	// 等待快照可用的轮询间隔
+	backupCheckTime = time.Second * 5
+)
+
+var log = ctrl.Log.WithName("backup")
+
+type BackupCtrl struct {
+	client.Client
+	recorder record.EventRecorder
+}
+
+type BackupCtrlFunc interface {
+	ScheduleBackup(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, time.Duration)
+	RunBackup(ctx context.Context, backup *iapetosapiv1.StatefulPodBackup) (bool, time.Duration)
+}
+
+func NewBackupCtrl(client client.Client, recorder record.EventRecorder) BackupCtrlFunc {
+	return &BackupCtrl{client, recorder}
+}
+
+// 按 backupPolicy.schedule 创建 StatefulPodBackup，并清理超出保留数量的备份
+// 返回 statefulPod status 是否改变以及距离下一次备份的时间
+func (b *BackupCtrl) ScheduleBackup(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, time.Duration) {
+	policy := statefulPod.Spec.BackupPolicy
+	if policy == nil || policy.Schedule == "" || !statefulPod.DeletionTimestamp.IsZero() {
+		return false, 0
+	}
+	// schedule 不合法时由 ValidateStatefulPod 记录到 status condition
+	schedule, err := cron.ParseStandard(policy.Schedule)
+	if err != nil {
+		log.Error(err, "parse backup schedule error", "statefulPod", statefulPod.Name)
+		return false, 0
+	}
+	last := statefulPod.CreationTimestamp.Time
+	if statefulPod.Status.LastBackupTime != nil {
+		last = statefulPod.Status.LastBackupTime.Time
+	}
+	now := time.Now()
+	changed := false
+	// 错过多次调度时只补做一次
+	if next := schedule.Next(last); !next.After(now) {
+		backupHandler := backupservice.NewBackupService(b.Client)
+		name := fmt.Sprintf("%v-%v", statefulPod.Name, next.Unix())
+		backup := backupHandler.CreateTemplate(ctx, statefulPod, name, 0)
+		if _, err := backupHandler.Create(ctx, backup); err != nil && !apierrors.IsAlreadyExists(err) {
+			services.RecordEvent(b.recorder, statefulPod, nil, corev1.EventTypeWarning, services.EventFailedCreate, "create statefulPodBackup %v failed: %v", name, err)
+			return false, backupCheckTime
+		}
+		services.RecordEvent(b.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventBackupScheduled, "create scheduled statefulPodBackup %v", name)
+		statefulPod.Status.LastBackupTime = &metav1.Time{Time: now}
+		changed = true
+	}
+	b.pruneBackups(ctx, statefulPod)
+	return changed, time.Until(schedule.Next(now))
+}
+
+// 按创建时间保留最新的 retention 个备份，正在进行中的备份不删除
+func (b *BackupCtrl) pruneBackups(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) {
+	retention := defaultRetention
+	if statefulPod.Spec.BackupPolicy.Retention != nil {
+		retention = int(*statefulPod.Spec.BackupPolicy.Retention)
+	}
+	var backupList iapetosapiv1.StatefulPodBackupList
+	// 只清理由调度创建的备份，手动创建的备份由用户管理
+	if err := b.List(ctx, &backupList, client.InNamespace(statefulPod.Namespace),
+		client.MatchingLabels{services.ParentNmae: statefulPod.Name, services.ScheduledBackup: "true"}); err != nil {
+		log.Error(err, "list statefulPodBackup error")
+		return
+	}
+	backups := make([]iapetosapiv1.StatefulPodBackup, 0, len(backupList.Items))
+	for _, backup := range backupList.Items {
+		if backup.Spec.StatefulPodName == statefulPod.Name && backup.DeletionTimestamp.IsZero() {
+			backups = append(backups, backup)
+		}
+	}
+	if len(backups) <= retention {
+		return
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[j].CreationTimestamp.Before(&backups[i].CreationTimestamp)
+	})
+	backupHandler := backupservice.NewBackupService(b.Client)
+	for i := retention; i < len(backups); i++ {
+		if phase := backups[i].Status.Phase; phase != iapetosapiv1.BackupCompleted && phase != iapetosapiv1.BackupFailed {
+			continue
+		}
+		if err := backupHandler.Delete(ctx, &backups[i]); err == nil {
+			services.RecordEvent(b.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventBackupPruned, "delete statefulPodBackup %v beyond retention %v", backups[i].Name, retention)
+		}
+	}
+}
+
+// 为 backup 创建成员快照并跟踪快照状态
+// 返回 backup status 是否改变以及下一次检查的等待时间
+func (b *BackupCtrl) RunBackup(ctx context.Context, backup *iapetosapiv1.StatefulPodBackup) (bool, time.Duration) {
+	switch backup.Status.Phase {
+	case iapetosapiv1.BackupCompleted, iapetosapiv1.BackupFailed:
+		return false, 0
+	}
+	var statefulPod iapetosapiv1.StatefulPod
+	if err := b.Get(ctx, types.NamespacedName{
+		Namespace: backup.Namespace,
+		Name:      backup.Spec.StatefulPodName,
+	}, &statefulPod); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "get statefulPod error")
+			return false, backupCheckTime
+		}
+		b.fail(backup, nil, "statefulPod not found")
+		return true, 0
+	}
+	if backup.Status.Phase == "" || backup.Status.Phase == iapetosapiv1.BackupPending {
+		return b.startBackup(backup, &statefulPod), 0
+	}
+
+	snapshotHandler := snapshot.NewSnapshotService(b.Client)
+	changed := false
+	done := true
+	for i := range backup.Status.Snapshots {
+		member := &backup.Status.Snapshots[i]
+		if member.ReadyToUse {
+			continue
+		}
+		done = false
+		if member.SnapshotName == "" {
+			obj := snapshot.BackupTemplate(&statefulPod, backup, member.PVCName, int(*member.Index))
+			if _, err := snapshotHandler.Create(ctx, obj); err != nil && !apierrors.IsAlreadyExists(err) {
+				return changed, backupCheckTime
+			}
+			member.SnapshotName = obj.GetName()
+			changed = true
+		} else if obj, ok := snapshotHandler.IsExists(ctx, types.NamespacedName{
+			Namespace: backup.Namespace,
+			Name:      member.SnapshotName,
+		}); ok {
+			volumeSnapshot := obj.(*unstructured.Unstructured)
+			if message := snapshot.GetErrorMessage(volumeSnapshot); message != "" {
+				b.fail(backup, &statefulPod, fmt.Sprintf("snapshot %v failed: %v", member.SnapshotName, message))
+				return true, 0
+			}
+			if snapshot.IsReadyToUse(volumeSnapshot) {
+				member.ReadyToUse = true
+				changed = true
+				continue
+			}
+		} else {
+			// 快照被删除，重新创建
+			member.SnapshotName = ""
+			changed = true
+		}
+		// 顺序备份时等待当前快照可用后再处理下一个成员
+		if backup.Spec.Mode != iapetosapiv1.BackupModeSimultaneous {
+			break
+		}
+	}
+	if done {
+		now := metav1.Now()
+		backup.Status.Phase = iapetosapiv1.BackupCompleted
+		backup.Status.CompletionTime = &now
+		services.RecordEvent(b.recorder, &statefulPod, backup, corev1.EventTypeNormal, services.EventBackupCompleted, "statefulPodBackup %v completed with %v snapshots", backup.Name, len(backup.Status.Snapshots))
+		return true, 0
+	}
+	return changed, backupCheckTime
+}
+
+// 根据 statefulPod 当前已绑定的 pvc 确定需要备份的成员
+func (b *BackupCtrl) startBackup(backup *iapetosapiv1.StatefulPodBackup, statefulPod *iapetosapiv1.StatefulPod) bool {
+	backup.Status.Snapshots = nil
+	for _, pvcStatus := range statefulPod.Status.PVCStatusMes {
+		if pvcStatus.Status != corev1.ClaimBound {
+			continue
+		}
+		backup.Status.Snapshots = append(backup.Status.Snapshots, iapetosapiv1.MemberSnapshot{
+			Index:   pvcStatus.Index,
+			PVCName: pvcStatus.PVCName,
+		})
+	}
+	if len(backup.Status.Snapshots) == 0 {
+		b.fail(backup, statefulPod, "statefulPod has no bound pvc")
+		return true
+	}
+	now := metav1.Now()
+	backup.Status.Phase = iapetosapiv1.BackupInProgress
+	backup.Status.StartTime = &now
+	return true
+}
+
+// statefulPod 不存在时只在 backup 上记录事件
+func (b *BackupCtrl) fail(backup *iapetosapiv1.StatefulPodBackup, statefulPod *iapetosapiv1.StatefulPod, message string) {
+	log.Error(errors.New(message), "backup failed", "backup", backup.Name)
+	services.RecordEvent(b.recorder, statefulPod, backup, corev1.EventTypeWarning, services.EventBackupFailed, "statefulPodBackup %v failed: %v", backup.Name, message)
+	now := metav1.Now()
+	backup.Status.Phase = iapetosapiv1.BackupFailed
+	backup.Status.Message = message
+	backup.Status.CompletionTime = &now
+}
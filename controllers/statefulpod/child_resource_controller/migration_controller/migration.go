@@ -0,0 +1,206 @@
+package migration_controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	"github.com/q8s-io/iapetos/services"
+	migrationservice "github.com/q8s-io/iapetos/services/migration"
+	podservice "github.com/q8s-io/iapetos/services/pod"
+	pvcservice "github.com/q8s-io/iapetos/services/pvc"
+	"github.com/q8s-io/iapetos/tools"
+)
+
+const (
+	Migrating = corev1.PodPhase(services.Migrating)
+	Deleting  = corev1.PodPhase("Deleting")
+
+	// 等待 StatefulSet 删除 pod、新成员运行的轮询间隔
+	migrationCheckTime = time.Second * 2
+)
+
+var errNotEmpty = errors.New("statefulPod already has members, only a new statefulPod can migrate from a statefulSet")
+
+type MigrationCtrl struct {
+	client.Client
+	recorder record.EventRecorder
+}
+
+type MigrationCtrlFunc interface {
+	Migrate(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, time.Duration, error)
+}
+
+func NewMigrationCtrl(client client.Client, recorder record.EventRecorder) MigrationCtrlFunc {
+	return &MigrationCtrl{client, recorder}
+}
+
+// 从 StatefulSet 迁移
+// 开始时为所有成员记录 Migrating 状态，之后从序号最大的成员开始，逐个缩容 StatefulSet，
+// 待 StatefulSet 删除该 pod 后将成员置为 Deleting，由 MaintainPod 重建 pod 并认领原有的 pvc，
+// 上一个成员运行后再迁移下一个，全部迁移完成后删除 StatefulSet 并保留其 pod
+// 返回 statefulPod status 是否改变以及需要重新检查的等待时间，获取、缩容、删除 StatefulSet 失败时返回错误
+func (m *MigrationCtrl) Migrate(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, time.Duration, error) {
+	if statefulPod.Spec.MigrateFrom == nil || !statefulPod.DeletionTimestamp.IsZero() {
+		return false, 0, nil
+	}
+	migration := statefulPod.Status.Migration
+	if migration != nil && migration.Phase != iapetosapiv1.MigrationInProgress {
+		return false, 0, nil
+	}
+	var statefulSet appsv1.StatefulSet
+	if err := m.Get(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      statefulPod.Spec.MigrateFrom.StatefulSetName,
+	}, &statefulSet); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return false, 0, err
+		}
+		if migration == nil {
+			m.finish(statefulPod, iapetosapiv1.MigrationFailed, "statefulSet not found")
+		} else {
+			// StatefulSet 已被删除，剩余的成员由 MaintainPod 重建
+			m.handOverAll(statefulPod)
+			m.finish(statefulPod, iapetosapiv1.MigrationCompleted, "")
+		}
+		return true, 0, nil
+	}
+	if migration == nil {
+		return m.start(ctx, statefulPod, migrationservice.Validate(statefulPod, &statefulSet)), 0, nil
+	}
+
+	// 序号最大的迁移中成员
+	index := -1
+	for i, podStatus := range statefulPod.Status.PodStatusMes {
+		if podStatus.Status == Migrating {
+			index = i
+		}
+	}
+	if index == -1 {
+		// 删除 StatefulSet，不删除其 pod
+		if err := m.Delete(ctx, &statefulSet, client.PropagationPolicy(metav1.DeletePropagationOrphan)); client.IgnoreNotFound(err) != nil {
+			services.RecordEvent(m.recorder, statefulPod, nil, corev1.EventTypeWarning, services.EventFailedDelete, "delete statefulSet %v failed: %v", statefulSet.Name, err)
+			return false, 0, err
+		}
+		m.finish(statefulPod, iapetosapiv1.MigrationCompleted, "")
+		return true, 0, nil
+	}
+	// 等待上一个迁移的成员运行
+	if next := index + 1; next < len(statefulPod.Status.PodStatusMes) && statefulPod.Status.PodStatusMes[next].Status != corev1.PodRunning {
+		return false, migrationCheckTime, nil
+	}
+	// 缩容 StatefulSet，由 StatefulSet 控制器删除序号最大的 pod
+	if statefulSet.Spec.Replicas == nil || *statefulSet.Spec.Replicas > int32(index) {
+		replicas := int32(index)
+		statefulSet.Spec.Replicas = &replicas
+		if err := m.Update(ctx, &statefulSet); err != nil {
+			return false, 0, err
+		}
+		services.RecordEvent(m.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventMigrate, "scale statefulSet %v to %v to migrate member %v", statefulSet.Name, index, index)
+		return false, migrationCheckTime, nil
+	}
+	// 等待 StatefulSet 删除 pod
+	podHandler := podservice.NewPodService(m.Client)
+	if obj, ok := podHandler.IsExists(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      statefulPod.Status.PodStatusMes[index].PodName,
+	}); ok && !metav1.IsControlledBy(obj.(*corev1.Pod), statefulPod) {
+		return false, migrationCheckTime, nil
+	}
+	services.SetPodPhase(&statefulPod.Status.PodStatusMes[index], Deleting, iapetosapiv1.ReasonMigration, fmt.Sprintf("pod removed from statefulSet %v", statefulSet.Name))
+	return true, migrationCheckTime, nil
+}
+
+// 为所有成员记录 Migrating 状态，pvc 沿用 StatefulSet 创建的 pvc
+func (m *MigrationCtrl) start(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, err error) bool {
+	if err == nil && len(statefulPod.Status.PodStatusMes) != 0 {
+		err = errNotEmpty
+	}
+	if err != nil {
+		m.finish(statefulPod, iapetosapiv1.MigrationFailed, err.Error())
+		return true
+	}
+	podHandler := podservice.NewPodService(m.Client)
+	pvcHandler := pvcservice.NewPVCService(m.Client)
+	for i := 0; i < int(*statefulPod.Spec.Size); i++ {
+		podStatus := iapetosapiv1.PodStatus{
+			PodName: *podHandler.GetName(statefulPod, i),
+			Index:   tools.IntToIntr32(i),
+		}
+		services.SetPodPhase(&podStatus, Migrating, iapetosapiv1.ReasonMigration, fmt.Sprintf("pod is managed by statefulSet %v", statefulPod.Spec.MigrateFrom.StatefulSetName))
+		if obj, ok := podHandler.IsExists(ctx, types.NamespacedName{
+			Namespace: statefulPod.Namespace,
+			Name:      podStatus.PodName,
+		}); ok {
+			podStatus.NodeName = obj.(*corev1.Pod).Spec.NodeName
+		}
+		pvcStatus := iapetosapiv1.PVCStatus{
+			Index:       tools.IntToIntr32(i),
+			PVCName:     "none",
+			AccessModes: []corev1.PersistentVolumeAccessMode{"none"},
+		}
+		if statefulPod.Spec.PVCTemplate != nil {
+			pvcStatus.PVCName = *pvcHandler.GetName(statefulPod, i)
+			pvcStatus.Status = corev1.ClaimPending
+			pvcStatus.AccessModes = statefulPod.Spec.PVCTemplate.AccessModes
+			if obj, ok := pvcHandler.IsExists(ctx, types.NamespacedName{
+				Namespace: statefulPod.Namespace,
+				Name:      pvcStatus.PVCName,
+			}); ok {
+				pvc := obj.(*corev1.PersistentVolumeClaim)
+				pvcStatus.Status = pvc.Status.Phase
+				pvcStatus.PVName = pvc.Spec.VolumeName
+				if pvc.Spec.StorageClassName != nil {
+					pvcStatus.StorageClass = *pvc.Spec.StorageClassName
+				}
+				capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+				pvcStatus.Capacity = capacity.String()
+			}
+		}
+		statefulPod.Status.PodStatusMes = append(statefulPod.Status.PodStatusMes, podStatus)
+		statefulPod.Status.PVCStatusMes = append(statefulPod.Status.PVCStatusMes, pvcStatus)
+	}
+	now := metav1.Now()
+	statefulPod.Status.Migration = &iapetosapiv1.MigrationStatus{
+		StatefulSetName: statefulPod.Spec.MigrateFrom.StatefulSetName,
+		Phase:           iapetosapiv1.MigrationInProgress,
+		StartTime:       &now,
+	}
+	return true
+}
+
+// 将所有迁移中的成员交给 MaintainPod 重建
+func (m *MigrationCtrl) handOverAll(statefulPod *iapetosapiv1.StatefulPod) {
+	for i := range statefulPod.Status.PodStatusMes {
+		if statefulPod.Status.PodStatusMes[i].Status == Migrating {
+			services.SetPodPhase(&statefulPod.Status.PodStatusMes[i], Deleting, iapetosapiv1.ReasonMigration, "statefulSet is gone")
+		}
+	}
+}
+
+func (m *MigrationCtrl) finish(statefulPod *iapetosapiv1.StatefulPod, phase iapetosapiv1.MigrationPhase, message string) {
+	if phase == iapetosapiv1.MigrationFailed {
+		services.RecordEvent(m.recorder, statefulPod, nil, corev1.EventTypeWarning, services.EventMigrationFailed, "migration from statefulSet %v failed: %v", statefulPod.Spec.MigrateFrom.StatefulSetName, message)
+	} else {
+		services.RecordEvent(m.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventMigrationCompleted, "migration from statefulSet %v completed", statefulPod.Spec.MigrateFrom.StatefulSetName)
+	}
+	now := metav1.Now()
+	if statefulPod.Status.Migration == nil {
+		statefulPod.Status.Migration = &iapetosapiv1.MigrationStatus{
+			StatefulSetName: statefulPod.Spec.MigrateFrom.StatefulSetName,
+			StartTime:       &now,
+		}
+	}
+	statefulPod.Status.Migration.Phase = phase
+	statefulPod.Status.Migration.Message = message
+	statefulPod.Status.Migration.CompletionTime = &now
+}
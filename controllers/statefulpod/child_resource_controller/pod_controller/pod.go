@@ -2,46 +2,60 @@ package pod_controller
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
 	"github.com/q8s-io/iapetos/controllers/statefulpod/child_resource_controller/pvc_controller"
+	"github.com/q8s-io/iapetos/metrics"
 	resourcecfg "github.com/q8s-io/iapetos/initconfig"
 	"github.com/q8s-io/iapetos/services"
+	"github.com/q8s-io/iapetos/services/fencing"
+	"github.com/q8s-io/iapetos/tools"
 	podservice "github.com/q8s-io/iapetos/services/pod"
-	pvcservice "github.com/q8s-io/iapetos/services/pvc"
 )
 
 type PodCtrl struct {
 	client.Client
+	recorder record.EventRecorder
 }
 
 const (
 	Preparing     = corev1.PodPhase("Preparing")
 	Deleting      = corev1.PodPhase("Deleting")
 	CreateTimeOut = corev1.PodPhase("CreateTimeOut")
+	// node 失联，等待隔离确认、pvc 处理完毕后再创建替代成员
+	Fencing = corev1.PodPhase("Fencing")
+	// 成员仍由迁移来源的 StatefulSet 管理
+	Migrating = corev1.PodPhase(services.Migrating)
 	//TimeOutIndex="TimeOutIndex"
+
+	failoverRetryTime = time.Second * 2
 )
 
 type PodCtrlFunc interface {
 	ExpansionPod(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (*iapetosapiv1.PodStatus, error)
-	ShrinkPod(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) bool
-	DeletePodAll(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) bool
+	ShrinkPod(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, error)
+	DeletePodAll(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, error)
 	MaintainPod(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) *int
-	MonitorPodStatus(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pod *corev1.Pod, index *int) bool
+	MonitorPodStatus(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pod *corev1.Pod, index *int) (bool, time.Duration, error)
 	PodIsOk(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) *int
+	MaintainNode(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, time.Duration, error)
 	//IsCreationPodTimeout(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) bool
 	IsPodDeleting(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) bool
+	ClaimPods(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) error
+	RollingRestart(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, time.Duration, error)
 	//CodbPodReady(ctx context.Context,statefulPod *iapetosapiv1.StatefulPod)(error)
 }
 
-func NewPodCtrl(client client.Client) PodCtrlFunc {
-	return &PodCtrl{client}
+func NewPodCtrl(client client.Client, recorder record.EventRecorder) PodCtrlFunc {
+	return &PodCtrl{client, recorder}
 }
 
 func (podctrl *PodCtrl) IsPodDeleting(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) bool {
@@ -69,7 +83,7 @@ func (podctrl *PodCtrl) ExpansionPod(ctx context.Context, statefulPod *iapetosap
 	podHandler := podservice.NewPodService(podctrl.Client)
 	podName := podHandler.GetName(statefulPod, index)
 	podIndex := int32(index)
-	if _, ok := podHandler.IsExists(ctx, types.NamespacedName{
+	if obj, ok := podHandler.IsExists(ctx, types.NamespacedName{
 		Namespace: statefulPod.Namespace,
 		Name:      *podName,
 	}); !ok { // pod 不存在，创建 pod
@@ -77,27 +91,89 @@ func (podctrl *PodCtrl) ExpansionPod(ctx context.Context, statefulPod *iapetosap
 		obj, err := podHandler.Create(ctx, podTemplate)
 		// 创建失败
 		if err != nil {
+			services.RecordEvent(podctrl.recorder, statefulPod, nil, corev1.EventTypeWarning, services.EventFailedCreate, "create pod %v failed: %v", *podName, err)
 			return nil, err
 		}
+		services.RecordEvent(podctrl.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventSuccessfulCreate, "create pod %v", *podName)
 		// 记录pod的status
 		podStatus := &iapetosapiv1.PodStatus{
 			PodName: obj.(*corev1.Pod).Name,
-			Status:  Preparing,
 			Index:   &podIndex,
 		}
+		services.SetPodPhase(podStatus, Preparing, "", "")
 		return podStatus, nil
 		// pod 存在，podStatus 不变
 	} else {
+		// 同名 pod 不属于 statefulPod 时认领，无法认领时不能使用
+		if owned, err := claimPod(ctx, podctrl.Client, podctrl.recorder, statefulPod, obj.(*corev1.Pod)); err != nil {
+			return nil, err
+		} else if !owned {
+			return nil, fmt.Errorf("pod %v: %w", *podName, services.ErrNotOwned)
+		}
 		if index >= len(statefulPod.Status.PodStatusMes) {
-			return nil, errors.New("")
+			// 认领的 pod 作为新成员记录
+			podStatus := &iapetosapiv1.PodStatus{
+				PodName: *podName,
+				Index:   &podIndex,
+			}
+			services.SetPodPhase(podStatus, Preparing, "", "")
+			return podStatus, nil
 		}
 		podStatus := statefulPod.Status.PodStatusMes[index]
 		return &podStatus, nil
 	}
 }
 
-// 缩容 pod
-func (podctrl *PodCtrl) ShrinkPod(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) bool {
+func claimPod(ctx context.Context, c client.Client, recorder record.EventRecorder, statefulPod *iapetosapiv1.StatefulPod, pod *corev1.Pod) (bool, error) {
+	refManager, err := services.NewRefManager(c, recorder, statefulPod)
+	if err != nil {
+		return false, err
+	}
+	return refManager.ClaimPod(ctx, pod)
+}
+
+// 认领与成员同名的孤儿 pod，释放属于 statefulPod 但不再匹配的 pod
+// 只检查通过 controller 索引找到的 pod 以及按成员名称查找的 pod，不遍历 namespace 下所有的 pod
+func (podctrl *PodCtrl) ClaimPods(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) error {
+	refManager, err := services.NewRefManager(podctrl.Client, podctrl.recorder, statefulPod)
+	if err != nil {
+		return err
+	}
+	var pods corev1.PodList
+	if err := podctrl.List(ctx, &pods, client.InNamespace(statefulPod.Namespace),
+		client.MatchingFields{services.ControllerUIDField: string(statefulPod.UID)}); err != nil {
+		return err
+	}
+	for i := range pods.Items {
+		if _, err := refManager.ClaimPod(ctx, &pods.Items[i]); err != nil {
+			return err
+		}
+	}
+	podHandler := podservice.NewPodService(podctrl.Client)
+	for index := 0; index < int(*statefulPod.Spec.Size); index++ {
+		var pod corev1.Pod
+		if err := podctrl.Get(ctx, types.NamespacedName{
+			Namespace: statefulPod.Namespace,
+			Name:      *podHandler.GetName(statefulPod, index),
+		}, &pod); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		// 有 controller 的 pod 已在上面处理，或属于其他控制器
+		if metav1.GetControllerOf(&pod) != nil {
+			continue
+		}
+		if _, err := refManager.ClaimPod(ctx, &pod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 缩容 pod，返回 pod 是否删除完毕
+func (podctrl *PodCtrl) ShrinkPod(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, error) {
 	podHandler := podservice.NewPodService(podctrl.Client)
 	podName := podHandler.GetName(statefulPod, index)
 	if pod, ok := podHandler.IsExists(ctx, types.NamespacedName{
@@ -105,34 +181,42 @@ func (podctrl *PodCtrl) ShrinkPod(ctx context.Context, statefulPod *iapetosapiv1
 		Name:      *podName,
 	}); ok {
 		if err := podHandler.Delete(ctx, pod); err != nil {
-			return false
+			services.RecordEvent(podctrl.recorder, statefulPod, pod.(*corev1.Pod), corev1.EventTypeWarning, services.EventFailedDelete, "delete pod %v failed: %v", *podName, err)
+			return false, err
 		}
-		// pod 删除完毕
+		if pod.(*corev1.Pod).DeletionTimestamp.IsZero() {
+			services.RecordEvent(podctrl.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventSuccessfulDelete, "delete pod %v", *podName)
+		}
+		// 等待 pod 删除完毕
 	} else {
-		return true
+		return true, nil
 	}
-	return false
+	return false, nil
 }
 
-func (podctrl *PodCtrl) DeletePodAll(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) bool {
+// 删除所有成员 pod，返回是否删除完毕
+func (podctrl *PodCtrl) DeletePodAll(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, error) {
 	podHandler := podservice.NewPodService(podctrl.Client)
 	sum := 0
 	for _, v := range statefulPod.Status.PodStatusMes {
+		// 迁移中的 pod 仍属于 StatefulSet
+		if v.Status == Migrating {
+			sum++
+			continue
+		}
 		if pod, ok := podHandler.IsExists(ctx, types.NamespacedName{
 			Namespace: statefulPod.Namespace,
 			Name:      v.PodName,
 		}); ok { // pod 存在，删除 pod
 			if err := podHandler.Delete(ctx, pod); err != nil {
-				return false
+				services.RecordEvent(podctrl.recorder, statefulPod, pod.(*corev1.Pod), corev1.EventTypeWarning, services.EventFailedDelete, "delete pod %v failed: %v", v.PodName, err)
+				return false, err
 			}
 		} else {
 			sum++
 		}
 	}
-	if sum == len(statefulPod.Status.PVCStatusMes) {
-		return true
-	}
-	return false
+	return sum == len(statefulPod.Status.PVCStatusMes), nil
 }
 
 func (podctrl *PodCtrl) MaintainPod(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) *int {
@@ -151,16 +235,20 @@ func (podctrl *PodCtrl) MaintainPod(ctx context.Context, statefulPod *iapetosapi
 func (podctrl *PodCtrl) PodIsOk(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) *int {
 	podHandler := podservice.NewPodService(podctrl.Client)
 	for i, podMsg := range statefulPod.Status.PodStatusMes {
+		// 隔离中的成员由 MaintainNode 处理，迁移中的成员由迁移流程处理
+		if podMsg.Status == Fencing || podMsg.Status == Migrating {
+			continue
+		}
 		if obj, ok := podHandler.IsExists(ctx, types.NamespacedName{
 			Namespace: statefulPod.Namespace,
 			Name:      podMsg.PodName,
 		}); !ok {
-			statefulPod.Status.PodStatusMes[i].Status = Deleting
+			services.SetPodPhase(&statefulPod.Status.PodStatusMes[i], Deleting, iapetosapiv1.ReasonPodNotFound, fmt.Sprintf("pod %v not found", podMsg.PodName))
 			return &i
 		} else {
 			pod := obj.(*corev1.Pod)
 			if pod.Status.Phase == corev1.PodRunning && statefulPod.Status.PodStatusMes[i].Status != corev1.PodRunning {
-				statefulPod.Status.PodStatusMes[i].Status = corev1.PodRunning
+				services.SetPodPhase(&statefulPod.Status.PodStatusMes[i], corev1.PodRunning, "", "")
 				return &i
 			}
 		}
@@ -168,91 +256,328 @@ func (podctrl *PodCtrl) PodIsOk(ctx context.Context, statefulPod *iapetosapiv1.S
 	return nil
 }
 
-func (podctrl *PodCtrl) MonitorPodStatus(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pod *corev1.Pod, index *int) bool {
+// 处理 pod 状态变化，返回 statefulPod 是否需要更新，以及需要重新检查的等待时间（node 失联超时、pod 创建超时）
+// 出错时 statefulPod 仍可能需要更新
+func (podctrl *PodCtrl) MonitorPodStatus(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pod *corev1.Pod, index *int) (bool, time.Duration, error) {
 	if *index >= len(statefulPod.Status.PodStatusMes) {
-		return false
+		return false, 0, nil
+	}
+	podStatus := &statefulPod.Status.PodStatusMes[*index]
+	// 隔离中的成员由 MaintainNode 处理，迁移中的成员由迁移流程处理
+	if podStatus.Status == Fencing || podStatus.Status == Migrating {
+		return false, 0, nil
 	}
-	podHandler := podservice.NewPodService(podctrl.Client)
-	pvcHandler := pvcservice.NewPVCService(podctrl.Client)
-	//pvcHandler := pvcservice.NewPVCService(podctrl.Client)
-	resourceHandle := services.NewResource(podctrl.Client)
 	if !pod.DeletionTimestamp.IsZero() {
+		// 创建超时的 pod 删除中，继续处理其 pvc
+		if podStatus.Status == CreateTimeOut {
+			changed, err := podctrl.createTimeOut(ctx, statefulPod, pod, *index)
+			return changed, 0, err
+		}
 		// 设置过 deleting 状态则不再进行设置
-		if statefulPod.Status.PodStatusMes[*index].Status == Deleting || statefulPod.Status.PodStatusMes[*index].Status == CreateTimeOut {
-			return false
+		if podStatus.Status == Deleting {
+			return false, 0, nil
 		}
-		statefulPod.Status.PodStatusMes[*index].Status = Deleting
-		return true
+		reason, message := iapetosapiv1.ReasonPodTerminating, fmt.Sprintf("pod %v is terminating", pod.Name)
+		if restartedAt := statefulPod.Annotations[iapetosapiv1.RestartedAtAnnotation]; restartedAt != "" && pod.Annotations[iapetosapiv1.RestartedAtAnnotation] != restartedAt {
+			reason, message = iapetosapiv1.ReasonRollingRestart, fmt.Sprintf("restarted at %v", restartedAt)
+		}
+		services.SetPodPhase(podStatus, Deleting, reason, message)
+		return true, 0, nil
 	}
+	// 记录就绪状态与重启次数
+	observed := services.ObservePod(podStatus, pod)
 
 	// node Unhealthy
-	if !resourceHandle.IsNodeReady(ctx, types.NamespacedName{
-		Namespace: "",
-		Name:      pod.Spec.NodeName,
-	}) {
-		// 立即删除 pod
-		if err := podHandler.DeleteMandatory(ctx, pod, statefulPod); err != nil {
-			return false
-		}
-		if statefulPod.Spec.PVCTemplate != nil {
-			if obj, ok := pvcHandler.IsExists(ctx, types.NamespacedName{
-				Namespace: statefulPod.Namespace,
-				Name:      *pvcHandler.GetName(statefulPod, *index),
-			}); ok {
-				pvc := obj.(*corev1.PersistentVolumeClaim)
-				if err := pvcHandler.DeleteMandatory(ctx, pvc, statefulPod); err != nil {
-					return false
-				}
-			}
-		}
-		statefulPod.Status.PodStatusMes[*index].Status = Deleting
-		statefulPod.Status.PVCStatusMes[*index].Status = pvc_controller.Deleting
-		return true
+	nodeLost, nodeRequeueAfter := podctrl.checkNode(ctx, pod)
+	if nodeLost {
+		changed, requeueAfter, err := podctrl.nodeLost(ctx, statefulPod, pod, *index)
+		return changed || observed, requeueAfter, err
 	}
 
 	// pod running
 	if podctrl.isPodRunning(pod) {
-		if statefulPod.Status.PodStatusMes[*index].Status == corev1.PodRunning {
-			return false
+		if podStatus.Status == corev1.PodRunning {
+			return observed, nodeRequeueAfter, nil
 		}
-		statefulPod.Status.PodStatusMes[*index].PodName = pod.Name
-		statefulPod.Status.PodStatusMes[*index].Status = corev1.PodRunning
-		statefulPod.Status.PodStatusMes[*index].NodeName = pod.Spec.NodeName
-		return true
+		if podStatus.Status == Preparing {
+			metrics.ObserveSince(metrics.MemberStartupDuration, statefulPod, &pod.CreationTimestamp)
+		}
+		podStatus.PodName = pod.Name
+		podStatus.NodeName = pod.Spec.NodeName
+		services.SetPodPhase(podStatus, corev1.PodRunning, "", "")
+		podStatus.Ready = true
+		return true, nodeRequeueAfter, nil
 	}
 
-	if statefulPod.Status.PodStatusMes[*index].Status == CreateTimeOut {
+	if podStatus.Status == CreateTimeOut {
+		changed, err := podctrl.createTimeOut(ctx, statefulPod, pod, *index)
+		return changed || observed, 0, err
+	}
+	// 记录 pod 未运行的原因
+	reason, message := services.PodWaitingReason(pod)
+	// pod创建超时
+	timeOut := time.Second * time.Duration(resourcecfg.Get().Pod.Timeout)
+	createRequeueAfter := time.Until(pod.CreationTimestamp.Add(timeOut))
+	if createRequeueAfter <= 0 {
+		if reason == "" {
+			reason, message = iapetosapiv1.ReasonCreateTimeout, fmt.Sprintf("pod %v is not running after %v", pod.Name, timeOut)
+		}
+		services.SetPodPhase(podStatus, CreateTimeOut, reason, message)
+		metrics.CreateTimeouts.WithLabelValues(statefulPod.Namespace, statefulPod.Name).Inc()
+		services.RecordEvent(podctrl.recorder, statefulPod, pod, corev1.EventTypeWarning, services.EventCreateTimeout, "pod %v create timeout: %v %v", pod.Name, reason, message)
+		return true, 0, nil
+	}
+	if podStatus.Reason != reason || podStatus.Message != message {
+		podStatus.Reason = reason
+		podStatus.Message = message
+		observed = true
+	}
+	return observed, tools.MinRequeueAfter(nodeRequeueAfter, createRequeueAfter), nil
+}
+
+// 删除创建超时的 pod，隔离 pv 并删除 pvc
+// 初始化创建时超时，移除该成员；维护时超时，将成员置为 deleting 等待重新创建
+// 返回 statefulPod 是否需要更新，出错时仍可能需要更新
+func (podctrl *PodCtrl) createTimeOut(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pod *corev1.Pod, index int) (bool, error) {
+	podHandler := podservice.NewPodService(podctrl.Client)
+	if pod.DeletionTimestamp.IsZero() {
 		if err := podHandler.Delete(ctx, pod); err != nil {
-			return false
+			services.RecordEvent(podctrl.recorder, statefulPod, pod, corev1.EventTypeWarning, services.EventFailedDelete, "delete pod %v failed: %v", pod.Name, err)
+			return false, err
 		}
-		if statefulPod.Spec.PVCTemplate!=nil{
-			if obj, ok := pvcHandler.IsExists(ctx, types.NamespacedName{
-				Namespace: pod.Namespace,
-				Name:      *pvcHandler.GetName(statefulPod, *index),
-			}); ok {
-				pvc := obj.(*corev1.PersistentVolumeClaim)
-			DELETEPVC: // 等待pvc删除完毕，这里不是幂等关系，一次一定要等pvc删除成功
-				if err := pvcHandler.Delete(ctx, pvc); err != nil {
-					goto DELETEPVC
-				}
+		services.RecordEvent(podctrl.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventSuccessfulDelete, "delete pod %v after create timeout", pod.Name)
+	}
+	// 删除失败时保持 CreateTimeOut 状态，由 workqueue 退避重试；隔离的 pv 已记录时需要更新
+	if err := pvc_controller.NewPVCCtrl(podctrl.Client, podctrl.recorder).ReleasePVC(ctx, statefulPod, index, iapetosapiv1.ReasonCreateTimeout); err != nil {
+		return true, err
+	}
+	// 初始化创建时超时
+	if index == len(statefulPod.Status.PodStatusMes)-1 {
+		statefulPod.Status.PodStatusMes = statefulPod.Status.PodStatusMes[:index]
+		statefulPod.Status.PVCStatusMes = statefulPod.Status.PVCStatusMes[:index]
+	} else { // 维护创建时超时
+		podStatus := &statefulPod.Status.PodStatusMes[index]
+		services.SetPodPhase(podStatus, Deleting, podStatus.Reason, podStatus.Message)
+		services.SetPVCPhase(&statefulPod.Status.PVCStatusMes[index], pvc_controller.Deleting, iapetosapiv1.ReasonCreateTimeout, fmt.Sprintf("pod %v create timeout", pod.Name))
+	}
+	return true, nil
+}
+
+// 检查所有 pod 所在的 node，node 失联超时则强制删除 pod、pvc
+// 返回 statefulPod 是否需要更新，以及距离最近一个不健康 node 失联超时的时间
+// 某个成员出错时继续处理其他成员，返回第一个错误
+func (podctrl *PodCtrl) MaintainNode(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, time.Duration, error) {
+	podHandler := podservice.NewPodService(podctrl.Client)
+	changed := false
+	var requeueAfter time.Duration
+	var firstErr error
+	for i, podMsg := range statefulPod.Status.PodStatusMes {
+		if podMsg.Status == Fencing {
+			fenceChanged, fenceRequeueAfter, err := podctrl.fence(ctx, statefulPod, i)
+			if fenceChanged {
+				changed = true
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
 			}
+			requeueAfter = tools.MinRequeueAfter(requeueAfter, fenceRequeueAfter)
+			continue
 		}
-		// 初始化创建时超时
-		if *index == len(statefulPod.Status.PodStatusMes)-1 {
-			statefulPod.Status.PodStatusMes = statefulPod.Status.PodStatusMes[:*index]
-			statefulPod.Status.PVCStatusMes = statefulPod.Status.PVCStatusMes[:*index]
-		} else { // 维护创建时超时
-			statefulPod.Status.PodStatusMes[*index].Status = Deleting
-			statefulPod.Status.PVCStatusMes[*index].Status = pvc_controller.Deleting
+		if podMsg.Status == Deleting || podMsg.Status == CreateTimeOut || podMsg.Status == Migrating {
+			continue
 		}
-		return true
+		obj, ok := podHandler.IsExists(ctx, types.NamespacedName{
+			Namespace: statefulPod.Namespace,
+			Name:      podMsg.PodName,
+		})
+		if !ok {
+			continue
+		}
+		pod := obj.(*corev1.Pod)
+		if !pod.DeletionTimestamp.IsZero() {
+			continue
+		}
+		nodeLost, nodeRequeueAfter := podctrl.checkNode(ctx, pod)
+		if nodeLost {
+			lostChanged, lostRequeueAfter, err := podctrl.nodeLost(ctx, statefulPod, pod, i)
+			if lostChanged {
+				changed = true
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			requeueAfter = tools.MinRequeueAfter(requeueAfter, lostRequeueAfter)
+			continue
+		}
+		requeueAfter = tools.MinRequeueAfter(requeueAfter, nodeRequeueAfter)
 	}
-	// pod创建超时
-	if !podctrl.isPodRunning(pod) && time.Now().Sub(pod.CreationTimestamp.Time) >= time.Second*time.Duration(resourcecfg.StatefulPodResourceCfg.Pod.Timeout) {
-		statefulPod.Status.PodStatusMes[*index].Status = CreateTimeOut
-		return true
+	return changed, requeueAfter, firstErr
+}
+
+// 判断 pod 所在 node 是否失联，node 不健康但尚未超时时返回距离超时的时间
+func (podctrl *PodCtrl) checkNode(ctx context.Context, pod *corev1.Pod) (bool, time.Duration) {
+	// 手动触发的 failover
+	if _, ok := pod.Annotations[iapetosapiv1.ForceFailoverAnnotation]; ok {
+		return true, 0
 	}
-	return false
+	resourceHandle := services.NewResource(podctrl.Client)
+	lostTime, err := resourceHandle.NodeLostTime(ctx, types.NamespacedName{
+		Namespace: "",
+		Name:      pod.Spec.NodeName,
+	})
+	if err != nil || lostTime == nil {
+		return false, 0
+	}
+	if requeueAfter := time.Until(*lostTime); requeueAfter > 0 {
+		return false, requeueAfter
+	}
+	return true, 0
+}
+
+// node 失联，需要隔离 node 或先为 pvc 创建快照时进入隔离状态，否则立即替换成员
+// 手动 failover 只替换该成员，不隔离 node
+func (podctrl *PodCtrl) nodeLost(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pod *corev1.Pod, index int) (bool, time.Duration, error) {
+	reason, message := nodeLostReason(pod)
+	services.RecordEvent(podctrl.recorder, statefulPod, pod, corev1.EventTypeWarning, services.EventNodeLost, message)
+	fenceNode := statefulPod.Spec.Fencing != nil && reason != iapetosapiv1.ReasonForcedFailover
+	if fenceNode || statefulPod.Spec.FailoverVolumePolicy == iapetosapiv1.FailoverVolumeSnapshotThenRecreate {
+		services.SetPodPhase(&statefulPod.Status.PodStatusMes[index], Fencing, reason, message)
+		statefulPod.Status.PodStatusMes[index].NodeName = pod.Spec.NodeName
+		return true, 0, nil
+	}
+	return podctrl.replaceMember(ctx, statefulPod, index, reason)
+}
+
+// 隔离失联 node，隔离确认后强制删除 pod、解除 pv 挂载，再替换成员
+// 返回 statefulPod 是否需要更新，等待隔离确认、volume 解除挂载时返回重试等待时间
+func (podctrl *PodCtrl) fence(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, time.Duration, error) {
+	fencer := fencing.NewFencer(podctrl.Client)
+	podHandler := podservice.NewPodService(podctrl.Client)
+	nodeName := statefulPod.Status.PodStatusMes[index].NodeName
+	// 手动 failover 时 node 可能仍然健康，隔离 node 会驱逐其上所有的 pod
+	policy := statefulPod.Spec.Fencing
+	if statefulPod.Status.PodStatusMes[index].Reason == iapetosapiv1.ReasonForcedFailover {
+		policy = nil
+	}
+	if fenced, err := fencer.FenceNode(ctx, policy, nodeName); err != nil || !fenced {
+		return false, failoverRetryTime, err
+	}
+	// node 已确认隔离，强制删除 pod
+	if obj, ok := podHandler.IsExists(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      statefulPod.Status.PodStatusMes[index].PodName,
+	}); ok {
+		if policy != nil && obj.(*corev1.Pod).DeletionTimestamp.IsZero() {
+			services.RecordEvent(podctrl.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventFenced, "node %v fenced", nodeName)
+		}
+		if err := podctrl.forceDelete(ctx, statefulPod, obj.(*corev1.Pod)); err != nil {
+			return false, 0, err
+		}
+	}
+	if index < len(statefulPod.Status.PVCStatusMes) {
+		pvName := statefulPod.Status.PVCStatusMes[index].PVName
+		if detached, err := fencer.DetachVolume(ctx, policy, nodeName, pvName); err != nil || !detached {
+			return false, failoverRetryTime, err
+		}
+	}
+	return podctrl.replaceMember(ctx, statefulPod, index, statefulPod.Status.PodStatusMes[index].Reason)
+}
+
+// 强制删除成员的 pod，按 failoverVolumePolicy 处理 pvc，完成后将成员置为 deleting，由 MaintainPod 重新创建
+// 返回 statefulPod 是否需要更新，等待快照可用时返回重试等待时间，出错时 statefulPod 仍可能需要更新
+// reason 为 NodeLost 或 ForcedFailover
+func (podctrl *PodCtrl) replaceMember(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int, reason string) (bool, time.Duration, error) {
+	podHandler := podservice.NewPodService(podctrl.Client)
+	if obj, ok := podHandler.IsExists(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      statefulPod.Status.PodStatusMes[index].PodName,
+	}); ok {
+		if err := podctrl.forceDelete(ctx, statefulPod, obj.(*corev1.Pod)); err != nil {
+			return false, 0, err
+		}
+	}
+	changed, done, err := pvc_controller.NewPVCCtrl(podctrl.Client, podctrl.recorder).FailoverPVC(ctx, statefulPod, index)
+	if err != nil {
+		return changed, 0, err
+	}
+	if !done {
+		return changed, failoverRetryTime, nil
+	}
+	podStatus := &statefulPod.Status.PodStatusMes[index]
+	// 隔离时从进入 Fencing 开始计时
+	if podStatus.Status == Fencing {
+		metrics.ObserveSince(metrics.FailoverDuration, statefulPod, podStatus.LastTransitionTime)
+	} else {
+		metrics.FailoverDuration.WithLabelValues(statefulPod.Namespace, statefulPod.Name).Observe(0)
+	}
+	metrics.Failovers.WithLabelValues(statefulPod.Namespace, statefulPod.Name, reason).Inc()
+	services.SetPodPhase(podStatus, Deleting, reason, fmt.Sprintf("node %v is lost, member is being replaced", podStatus.NodeName))
+	return true, 0, nil
+}
+
+// 强制删除 node 失联的 pod
+func (podctrl *PodCtrl) forceDelete(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pod *corev1.Pod) error {
+	podHandler := podservice.NewPodService(podctrl.Client)
+	if err := podHandler.DeleteMandatory(ctx, pod, statefulPod); client.IgnoreNotFound(err) != nil {
+		services.RecordEvent(podctrl.recorder, statefulPod, pod, corev1.EventTypeWarning, services.EventFailedDelete, "force delete pod %v failed: %v", pod.Name, err)
+		return err
+	}
+	if pod.DeletionTimestamp.IsZero() {
+		metrics.ForcedDeletions.WithLabelValues(statefulPod.Namespace, statefulPod.Name).Inc()
+		services.RecordEvent(podctrl.recorder, statefulPod, nil, corev1.EventTypeWarning, services.EventForceDelete, "force delete pod %v on lost node %v", pod.Name, pod.Spec.NodeName)
+	}
+	return nil
+}
+
+// node 失联的原因以及说明，区分手动触发的 failover
+func nodeLostReason(pod *corev1.Pod) (string, string) {
+	if _, ok := pod.Annotations[iapetosapiv1.ForceFailoverAnnotation]; ok {
+		return iapetosapiv1.ReasonForcedFailover, fmt.Sprintf("failover of pod %v requested", pod.Name)
+	}
+	return iapetosapiv1.ReasonNodeLost, fmt.Sprintf("node %v is lost", pod.Spec.NodeName)
+}
+
+// 滚动重启，restartedAt annotation 与成员 pod 的不一致时，按序号删除 pod，由 MaintainPod 重建，pvc 保留
+// 前面的成员运行且就绪后才重启下一个，重建的 pod 从 statefulPod 继承 annotation
+// 返回 statefulPod status 是否改变以及需要重新检查的等待时间
+func (podctrl *PodCtrl) RollingRestart(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, time.Duration, error) {
+	restartedAt := statefulPod.Annotations[iapetosapiv1.RestartedAtAnnotation]
+	if restartedAt == "" || restartedAt == statefulPod.Status.RestartedAt {
+		return false, 0, nil
+	}
+	podHandler := podservice.NewPodService(podctrl.Client)
+	for _, podMsg := range statefulPod.Status.PodStatusMes {
+		// 成员未运行时等待 pod 事件，包括正在重建、隔离、迁移中的成员
+		if podMsg.Status != corev1.PodRunning {
+			return false, 0, nil
+		}
+		obj, ok := podHandler.IsExists(ctx, types.NamespacedName{
+			Namespace: statefulPod.Namespace,
+			Name:      podMsg.PodName,
+		})
+		if !ok {
+			return false, 0, nil
+		}
+		pod := obj.(*corev1.Pod)
+		if !pod.DeletionTimestamp.IsZero() {
+			return false, 0, nil
+		}
+		if pod.Annotations[iapetosapiv1.RestartedAtAnnotation] != restartedAt {
+			if err := podHandler.Delete(ctx, pod); err != nil {
+				services.RecordEvent(podctrl.recorder, statefulPod, pod, corev1.EventTypeWarning, services.EventFailedDelete, "delete pod %v for restart failed: %v", pod.Name, err)
+				return false, 0, err
+			}
+			services.RecordEvent(podctrl.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventSuccessfulDelete, "delete pod %v for restart at %v", pod.Name, restartedAt)
+			return false, 0, nil
+		}
+		// 已重启的成员持续就绪 minReady 后再处理下一个，在到期时重新检查
+		if available, requeueAfter := podctrl.isPodAvailable(pod); !available {
+			return false, requeueAfter, nil
+		}
+	}
+	statefulPod.Status.RestartedAt = restartedAt
+	services.RecordEvent(podctrl.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventRestartCompleted, "restart at %v completed", restartedAt)
+	return true, 0, nil
 }
 
 // pod 内所有的pod都是 running 和 ready 状态
@@ -267,3 +592,20 @@ func (podctrl *PodCtrl)isPodRunning(pod *corev1.Pod)bool{
 	}
 	return true
 }
+
+// pod 持续就绪 podConfig.ready 秒后视为可用，未到期时返回剩余时间，未就绪时等待 pod 事件
+func (podctrl *PodCtrl) isPodAvailable(pod *corev1.Pod) (bool, time.Duration) {
+	if !podctrl.isPodRunning(pod) {
+		return false, 0
+	}
+	minReady := time.Second * time.Duration(resourcecfg.Get().Pod.Ready)
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type != corev1.PodReady {
+			continue
+		}
+		if requeueAfter := time.Until(condition.LastTransitionTime.Add(minReady)); requeueAfter > 0 {
+			return false, requeueAfter
+		}
+	}
+	return true, 0
+}
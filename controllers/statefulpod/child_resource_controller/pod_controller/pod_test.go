@@ -0,0 +1,46 @@
+package pod_controller
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	resourcecfg "github.com/q8s-io/iapetos/initconfig"
+)
+
+func readyPod(readySince time.Time) *corev1.Pod {
+	return &corev1.Pod{Status: corev1.PodStatus{
+		Phase: corev1.PodRunning,
+		Conditions: []corev1.PodCondition{{
+			Type:               corev1.PodReady,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(readySince),
+		}},
+	}}
+}
+
+func TestIsPodAvailable(t *testing.T) {
+	defer resourcecfg.Set(resourcecfg.Default())
+	config := resourcecfg.Default()
+	config.Pod.Ready = 60
+	resourcecfg.Set(config)
+	podctrl := &PodCtrl{}
+
+	// 就绪未满 minReady 时在到期时重新检查
+	available, requeueAfter := podctrl.isPodAvailable(readyPod(time.Now().Add(-time.Second * 20)))
+	if available || requeueAfter <= time.Second*30 || requeueAfter > time.Second*40 {
+		t.Fatalf("isPodAvailable() = %v, %v; want false, ~40s", available, requeueAfter)
+	}
+	if available, requeueAfter = podctrl.isPodAvailable(readyPod(time.Now().Add(-time.Minute * 2))); !available || requeueAfter != 0 {
+		t.Fatalf("isPodAvailable() = %v, %v; want true, 0", available, requeueAfter)
+	}
+
+	// 未就绪时等待 pod 事件
+	pod := readyPod(time.Now().Add(-time.Minute * 2))
+	pod.Status.Conditions[0].Status = corev1.ConditionFalse
+	if available, requeueAfter = podctrl.isPodAvailable(pod); available || requeueAfter != 0 {
+		t.Fatalf("isPodAvailable() = %v, %v; want false, 0", available, requeueAfter)
+	}
+}
@@ -2,34 +2,57 @@ package pv_controller
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	"github.com/q8s-io/iapetos/metrics"
+	"github.com/q8s-io/iapetos/services"
 	pvservice "github.com/q8s-io/iapetos/services/pv"
+	"github.com/q8s-io/iapetos/tools"
 )
 
 type PVCtrl struct {
 	client.Client
+	recorder record.EventRecorder
 }
 
 const redisSlave = "redis-slave"
 
+// 隔离 pv 使用的 label、annotation
+const (
+	QuarantinedLabel           = "iapetos.foundary-cloud.io/quarantined"
+	quarantineReasonAnnotation = "iapetos.foundary-cloud.io/quarantine-reason"
+	quarantinedAtAnnotation    = "iapetos.foundary-cloud.io/quarantined-at"
+	quarantinedFromAnnotation  = "iapetos.foundary-cloud.io/quarantined-from"
+	reclaimPolicyAnnotation    = "iapetos.foundary-cloud.io/original-reclaim-policy"
+
+	defaultQuarantineTTL = time.Hour * 24
+	// 超时的隔离 pv 恢复回收策略失败时的重试间隔
+	quarantineRetryTime = time.Second * 10
+)
+
 type PVCtrlFunc interface {
-	SetPVRetain(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) bool
-	SetPVAvailable(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) bool
+	SetPVRetain(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, error)
+	SetPVAvailable(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, error)
+	QuarantinePV(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pvc *corev1.PersistentVolumeClaim, index int, reason string) error
+	CleanQuarantinedPV(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, time.Duration, error)
 	//CodbPodReady(ctx context.Context,statefulPod *iapetosapiv1.StatefulPod)(error)
 }
 
-func NewPodCtrl(client client.Client) PVCtrlFunc {
-	return &PVCtrl{client}
+func NewPodCtrl(client client.Client, recorder record.EventRecorder) PVCtrlFunc {
+	return &PVCtrl{client, recorder}
 }
 
-func (pvctrl *PVCtrl) SetPVRetain(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) bool {
+func (pvctrl *PVCtrl) SetPVRetain(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, error) {
 	if statefulPod.Spec.PVRecyclePolicy != corev1.PersistentVolumeReclaimRetain {
-		return true
+		return true, nil
 	}
 	sum := 0
 	pvHandle := pvservice.NewPVService(pvctrl.Client)
@@ -51,21 +74,22 @@ func (pvctrl *PVCtrl) SetPVRetain(ctx context.Context, statefulPod *iapetosapiv1
 			pv.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
 			pv.Spec.StorageClassName = ""
 			if _, err := pvHandle.Update(ctx, pv); err != nil {
-				return false
+				return false, err
 			}
+			metrics.PVOperations.WithLabelValues(statefulPod.Namespace, statefulPod.Name, metrics.PVRetain).Inc()
+			services.RecordEvent(pvctrl.recorder, statefulPod, pv, corev1.EventTypeNormal, services.EventRetainPV, "set reclaim policy of pv %v to Retain", pv.Name)
 		} else if client.IgnoreNotFound(err) == nil { // pv 已被删除
 			sum++
+		} else {
+			return false, err
 		}
 	}
-	if sum == len(statefulPod.Status.PVCStatusMes) {
-		return true
-	}
-	return false
+	return sum == len(statefulPod.Status.PVCStatusMes), nil
 }
 
-func (pvctrl *PVCtrl) SetPVAvailable(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) bool {
+func (pvctrl *PVCtrl) SetPVAvailable(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, error) {
 	if statefulPod.Spec.PVRecyclePolicy != corev1.PersistentVolumeReclaimRetain {
-		return true
+		return true, nil
 	}
 	sum := 0
 	pvHandle := pvservice.NewPVService(pvctrl.Client)
@@ -87,15 +111,138 @@ func (pvctrl *PVCtrl) SetPVAvailable(ctx context.Context, statefulPod *iapetosap
 			pv.Spec.ClaimRef = nil
 			pv.Status.Phase = corev1.VolumeAvailable
 			if _, err := pvHandle.Update(ctx, pv); err != nil {
-				return false
+				return false, err
 			}
+			metrics.PVOperations.WithLabelValues(statefulPod.Namespace, statefulPod.Name, metrics.PVRelease).Inc()
+			services.RecordEvent(pvctrl.recorder, statefulPod, pv, corev1.EventTypeNormal, services.EventReleasePV, "release pv %v", pv.Name)
 		} else if client.IgnoreNotFound(err) == nil {
 			// delete 策略对pv 已被删除
 			sum++
+		} else {
+			return false, err
+		}
+	}
+	return sum == len(statefulPod.Status.PVCStatusMes), nil
+}
+
+// 是否隔离替换成员时的旧 pv
+func IsQuarantineEnabled(statefulPod *iapetosapiv1.StatefulPod) bool {
+	return statefulPod.Spec.QuarantinePolicy == nil || !statefulPod.Spec.QuarantinePolicy.Disabled
+}
+
+// 删除 pvc 前隔离其绑定的 pv：回收策略置为 Retain，记录隔离原因、时间以及原有的回收策略
+// pvc 未绑定 pv、pv 已被删除或不需要隔离时直接返回
+func (pvctrl *PVCtrl) QuarantinePV(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pvc *corev1.PersistentVolumeClaim, index int, reason string) error {
+	if !IsQuarantineEnabled(statefulPod) || pvc.Spec.VolumeName == "" {
+		return nil
+	}
+	pvHandle := pvservice.NewPVService(pvctrl.Client)
+	obj, err := pvHandle.Get(ctx, types.NamespacedName{
+		Namespace: corev1.NamespaceAll,
+		Name:      pvc.Spec.VolumeName,
+	})
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	pv := obj.(*corev1.PersistentVolume)
+	if _, ok := pv.Labels[QuarantinedLabel]; !ok {
+		now := metav1.Now()
+		if pv.Labels == nil {
+			pv.Labels = map[string]string{}
+		}
+		if pv.Annotations == nil {
+			pv.Annotations = map[string]string{}
+		}
+		pv.Labels[QuarantinedLabel] = "true"
+		pv.Annotations[quarantineReasonAnnotation] = reason
+		pv.Annotations[quarantinedAtAnnotation] = now.Format(time.RFC3339)
+		pv.Annotations[quarantinedFromAnnotation] = fmt.Sprintf("%v/%v/%v", statefulPod.Namespace, statefulPod.Name, index)
+		pv.Annotations[reclaimPolicyAnnotation] = string(pv.Spec.PersistentVolumeReclaimPolicy)
+		pv.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+		if _, err := pvHandle.Update(ctx, pv); err != nil {
+			return err
+		}
+		metrics.PVOperations.WithLabelValues(statefulPod.Namespace, statefulPod.Name, metrics.PVQuarantine).Inc()
+		services.RecordEvent(pvctrl.recorder, statefulPod, pv, corev1.EventTypeWarning, services.EventQuarantinePV, "quarantine pv %v of pvc %v: %v", pv.Name, pvc.Name, reason)
+	}
+	for _, volume := range statefulPod.Status.QuarantinedVolumes {
+		if volume.PVName == pv.Name {
+			return nil
+		}
+	}
+	quarantinedAt, err := time.Parse(time.RFC3339, pv.Annotations[quarantinedAtAnnotation])
+	if err != nil {
+		quarantinedAt = time.Now()
+	}
+	statefulPod.Status.QuarantinedVolumes = append(statefulPod.Status.QuarantinedVolumes, iapetosapiv1.QuarantinedVolume{
+		Index:         tools.IntToIntr32(index),
+		PVCName:       pvc.Name,
+		PVName:        pv.Name,
+		Reason:        pv.Annotations[quarantineReasonAnnotation],
+		QuarantinedAt: metav1.NewTime(quarantinedAt),
+	})
+	return nil
+}
+
+// 清理超过保留时间的隔离 pv
+// 恢复 pv 原有的回收策略，原策略为 Delete 时 pv 随后会被回收
+// 删除 statefulPod 时不清理，隔离 pv 保持 Retain，保留数据用于恢复
+// 返回 statefulPod 是否需要更新，以及距离下一个隔离 pv 超时的时间
+// 恢复失败的 pv 继续保留在隔离列表中，在重试间隔后重新处理，并返回第一个错误
+func (pvctrl *PVCtrl) CleanQuarantinedPV(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, time.Duration, error) {
+	if len(statefulPod.Status.QuarantinedVolumes) == 0 {
+		return false, 0, nil
+	}
+	ttl := defaultQuarantineTTL
+	if statefulPod.Spec.QuarantinePolicy != nil && statefulPod.Spec.QuarantinePolicy.TTLSeconds != nil {
+		ttl = time.Second * time.Duration(*statefulPod.Spec.QuarantinePolicy.TTLSeconds)
+	}
+	pvHandle := pvservice.NewPVService(pvctrl.Client)
+	changed := false
+	var requeueAfter time.Duration
+	var firstErr error
+	retry := func(err error) {
+		if firstErr == nil {
+			firstErr = err
 		}
+		requeueAfter = tools.MinRequeueAfter(requeueAfter, quarantineRetryTime)
 	}
-	if sum == len(statefulPod.Status.PVCStatusMes) {
-		return true
+	volumes := statefulPod.Status.QuarantinedVolumes[:0]
+	for _, volume := range statefulPod.Status.QuarantinedVolumes {
+		if wait := time.Until(volume.QuarantinedAt.Add(ttl)); wait > 0 {
+			if requeueAfter == 0 || wait < requeueAfter {
+				requeueAfter = wait
+			}
+			volumes = append(volumes, volume)
+			continue
+		}
+		if obj, err := pvHandle.Get(ctx, types.NamespacedName{
+			Namespace: corev1.NamespaceAll,
+			Name:      volume.PVName,
+		}); err == nil {
+			pv := obj.(*corev1.PersistentVolume)
+			if policy, ok := pv.Annotations[reclaimPolicyAnnotation]; ok && policy != "" {
+				pv.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimPolicy(policy)
+			}
+			delete(pv.Labels, QuarantinedLabel)
+			delete(pv.Annotations, quarantineReasonAnnotation)
+			delete(pv.Annotations, quarantinedAtAnnotation)
+			delete(pv.Annotations, quarantinedFromAnnotation)
+			delete(pv.Annotations, reclaimPolicyAnnotation)
+			if _, err := pvHandle.Update(ctx, pv); err != nil {
+				retry(err)
+				volumes = append(volumes, volume)
+				continue
+			}
+			metrics.PVOperations.WithLabelValues(statefulPod.Namespace, statefulPod.Name, metrics.PVRestore).Inc()
+			services.RecordEvent(pvctrl.recorder, statefulPod, pv, corev1.EventTypeNormal, services.EventRestorePV, "restore reclaim policy %v of quarantined pv %v", pv.Spec.PersistentVolumeReclaimPolicy, pv.Name)
+		} else if client.IgnoreNotFound(err) != nil {
+			retry(err)
+			volumes = append(volumes, volume)
+			continue
+		}
+		changed = true
 	}
-	return false
+	statefulPod.Status.QuarantinedVolumes = volumes
+	return changed, requeueAfter, firstErr
 }
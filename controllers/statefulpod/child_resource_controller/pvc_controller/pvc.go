@@ -2,20 +2,28 @@ package pvc_controller
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	pvctrl "github.com/q8s-io/iapetos/controllers/statefulpod/child_resource_controller/pv_controller"
+	"github.com/q8s-io/iapetos/services"
+	backupservice "github.com/q8s-io/iapetos/services/backup"
 	pvcservice "github.com/q8s-io/iapetos/services/pvc"
+	snapshotservice "github.com/q8s-io/iapetos/services/snapshot"
 	"github.com/q8s-io/iapetos/tools"
 )
 
 type PVCCtrl struct {
 	client.Client
+	recorder record.EventRecorder
 }
 
 const (
@@ -25,19 +33,26 @@ const (
 
 type PVCCtrlFunc interface {
 	ExpansionPVC(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (*iapetosapiv1.PVCStatus, error)
-	ShrinkPVC(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) bool
+	ShrinkPVC(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, error)
 	MonitorPVCStatus(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pvc *corev1.PersistentVolumeClaim, index int) bool
-	DeletePvcAll(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) bool
-	IsCreationPvcTimeout(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) bool
+	DeletePvcAll(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, error)
+	IsCreationPvcTimeout(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, error)
+	FailoverPVC(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, bool, error)
+	ReleasePVC(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int, reason string) error
+	IsDataSourceReady(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, error)
+	IsPVCRestored(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, error)
+	ClaimPVCs(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) error
+	CleanFailoverSnapshot(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, error)
 }
 
-func NewPVCCtrl(client client.Client) PVCCtrlFunc {
-	return &PVCCtrl{client}
+func NewPVCCtrl(client client.Client, recorder record.EventRecorder) PVCCtrlFunc {
+	return &PVCCtrl{client, recorder}
 }
 
-func (pvcctrl *PVCCtrl) IsCreationPvcTimeout(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) bool {
+// 删除创建超时成员的 pvc，返回 pvc 是否已不存在
+func (pvcctrl *PVCCtrl) IsCreationPvcTimeout(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, error) {
 	if statefulPod.Spec.PVCTemplate == nil {
-		return true
+		return true, nil
 	}
 	pvcHandler := pvcservice.NewPVCService(pvcctrl.Client)
 	pvcName := pvcHandler.GetName(statefulPod, index)
@@ -46,67 +61,184 @@ func (pvcctrl *PVCCtrl) IsCreationPvcTimeout(ctx context.Context, statefulPod *i
 		Name:      *pvcName,
 	}); ok {
 		pvc := obj.(*corev1.PersistentVolumeClaim)
-		// 删除pod
-		_ = pvcHandler.Delete(ctx, pvc)
-		return false
+		// 删除pvc
+		return false, pvcHandler.Delete(ctx, pvc)
 	} else {
 		// 不存在
-		return true
+		return true, nil
 	}
 }
 
-func (pvcctrl *PVCCtrl) DeletePvcAll(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) bool {
+// 新成员 pvc 的数据源是否可用，从备份恢复时等待备份完成，从 peer 播种时等待播种快照可用
+func (pvcctrl *PVCCtrl) IsDataSourceReady(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, error) {
+	if statefulPod.Spec.PVCTemplate == nil {
+		return true, nil
+	}
+	// 备份不存在或获取失败时返回错误，由 workqueue 退避重试
+	if _, _, ok, err := pvcservice.InitialDataSource(ctx, pvcctrl.Client, statefulPod, index); err != nil || ok {
+		return ok, err
+	}
+	peerIndex, ok := pvcservice.SeedSnapshotPeer(ctx, pvcctrl.Client, statefulPod, index)
+	if !ok {
+		return false, nil
+	}
+	// 为 peer 的 pvc 创建播种快照
+	snapshotHandler := snapshotservice.NewSnapshotService(pvcctrl.Client)
+	name := pvcservice.SeedSnapshotName(statefulPod, index)
+	if _, exists := snapshotHandler.IsExists(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      name,
+	}); !exists {
+		if _, err := snapshotHandler.Create(ctx, snapshotHandler.CreateTemplate(ctx, statefulPod, name, peerIndex)); err != nil && !apierrors.IsAlreadyExists(err) {
+			services.RecordEvent(pvcctrl.recorder, statefulPod, nil, corev1.EventTypeWarning, services.EventFailedCreate, "create volumeSnapshot %v failed: %v", name, err)
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// 删除所有成员 pvc，返回是否删除完毕
+func (pvcctrl *PVCCtrl) DeletePvcAll(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, error) {
 	pvcHandler := pvcservice.NewPVCService(pvcctrl.Client)
 	sum := 0
-	for _, v := range statefulPod.Status.PVCStatusMes {
+	for i, v := range statefulPod.Status.PVCStatusMes {
+		// 迁移中成员的 pvc 仍由 StatefulSet 使用
+		if i < len(statefulPod.Status.PodStatusMes) && statefulPod.Status.PodStatusMes[i].Status == corev1.PodPhase(services.Migrating) {
+			sum++
+			continue
+		}
 		if pod, ok := pvcHandler.IsExists(ctx, types.NamespacedName{
 			Namespace: statefulPod.Namespace,
 			Name:      v.PVCName,
-		}); ok { // pod 存在，删除 pod
-			fmt.Println("-------delete pvc--------")
+		}); ok { // pvc 存在，删除 pvc
 			if err := pvcHandler.Delete(ctx, pod); err != nil {
-				return false
+				services.RecordEvent(pvcctrl.recorder, statefulPod, pod.(*corev1.PersistentVolumeClaim), corev1.EventTypeWarning, services.EventFailedDelete, "delete pvc %v failed: %v", v.PVCName, err)
+				return false, err
 			}
 		} else {
 			sum++
 		}
 	}
-	if sum == len(statefulPod.Status.PVCStatusMes) {
-		return true
-	}
-	return false
+	return sum == len(statefulPod.Status.PVCStatusMes), nil
 }
 
 func (pvcctrl *PVCCtrl) ExpansionPVC(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (*iapetosapiv1.PVCStatus, error) {
 	pvcHandler := pvcservice.NewPVCService(pvcctrl.Client)
 	pvcName := pvcHandler.GetName(statefulPod, index)
-	if _, ok := pvcHandler.IsExists(ctx, types.NamespacedName{
+	if obj, ok := pvcHandler.IsExists(ctx, types.NamespacedName{
 		Namespace: statefulPod.Namespace,
 		Name:      *pvcName,
 	}); !ok { // pvc 不存在，创建 pvc
 		pvcTemplate := pvcHandler.CreateTemplate(ctx, statefulPod, *pvcName, index)
 		if _, err := pvcHandler.Create(ctx, pvcTemplate); err != nil {
+			services.RecordEvent(pvcctrl.recorder, statefulPod, nil, corev1.EventTypeWarning, services.EventFailedCreate, "create pvc %v failed: %v", *pvcName, err)
 			return nil, err
 		}
+		services.RecordEvent(pvcctrl.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventSuccessfulCreate, "create pvc %v", *pvcName)
 		pvcStatus := &iapetosapiv1.PVCStatus{
 			Index:        tools.IntToIntr32(index),
 			PVCName:      *pvcName,
-			Status:       corev1.ClaimPending,
 			AccessModes:  statefulPod.Spec.PVCTemplate.AccessModes,
-			StorageClass: *statefulPod.Spec.PVCTemplate.StorageClassName,
+			StorageClass: storageClassName(statefulPod),
+			DataSource:   pvcTemplate.(*corev1.PersistentVolumeClaim).Spec.DataSource,
+		}
+		services.SetPVCPhase(pvcStatus, corev1.ClaimPending, "", "")
+		// 记录播种的来源
+		if index >= len(statefulPod.Status.PVCStatusMes) && pvcStatus.DataSource != nil {
+			if _, peerPVCName, _, _ := pvcservice.InitialDataSource(ctx, pvcctrl.Client, statefulPod, index); peerPVCName != "" {
+				now := metav1.Now()
+				pvcStatus.SeededFrom = peerPVCName
+				pvcStatus.SeededAt = &now
+			}
 		}
 		return pvcStatus, nil
 		// pvc 存在，pvcStatus 不变
 	} else {
+		pvc := obj.(*corev1.PersistentVolumeClaim)
+		// 同名 pvc 不属于 statefulPod 时认领，无法认领时不能使用
+		if owned, err := claimPVC(ctx, pvcctrl.Client, pvcctrl.recorder, statefulPod, pvc); err != nil {
+			return nil, err
+		} else if !owned {
+			return nil, fmt.Errorf("pvc %v: %w", pvc.Name, services.ErrNotOwned)
+		}
 		if index >= len(statefulPod.Status.PVCStatusMes) {
-			return nil, errors.New("")
+			// 认领的 pvc 作为新成员记录，状态由 MonitorPVCStatus 更新
+			pvcStatus := &iapetosapiv1.PVCStatus{
+				Index:        tools.IntToIntr32(index),
+				PVCName:      *pvcName,
+				AccessModes:  pvc.Spec.AccessModes,
+				StorageClass: storageClassName(statefulPod),
+				DataSource:   pvc.Spec.DataSource,
+			}
+			services.SetPVCPhase(pvcStatus, corev1.ClaimPending, "", "")
+			return pvcStatus, nil
 		}
 		pvcStatus := statefulPod.Status.PVCStatusMes[index]
 		return &pvcStatus, nil
 	}
 }
 
-func (pvcctrl *PVCCtrl) ShrinkPVC(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) bool {
+// 未设置 storageClassName 时使用默认 StorageClass
+func storageClassName(statefulPod *iapetosapiv1.StatefulPod) string {
+	if statefulPod.Spec.PVCTemplate.StorageClassName == nil {
+		return ""
+	}
+	return *statefulPod.Spec.PVCTemplate.StorageClassName
+}
+
+func claimPVC(ctx context.Context, c client.Client, recorder record.EventRecorder, statefulPod *iapetosapiv1.StatefulPod, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	refManager, err := services.NewRefManager(c, recorder, statefulPod)
+	if err != nil {
+		return false, err
+	}
+	return refManager.ClaimPVC(ctx, pvc)
+}
+
+// 认领与成员同名的孤儿 pvc，释放属于 statefulPod 但不再匹配的 pvc
+// 只检查通过 controller 索引找到的 pvc 以及按成员名称查找的 pvc，不遍历 namespace 下所有的 pvc
+func (pvcctrl *PVCCtrl) ClaimPVCs(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) error {
+	refManager, err := services.NewRefManager(pvcctrl.Client, pvcctrl.recorder, statefulPod)
+	if err != nil {
+		return err
+	}
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := pvcctrl.List(ctx, &pvcs, client.InNamespace(statefulPod.Namespace),
+		client.MatchingFields{services.ControllerUIDField: string(statefulPod.UID)}); err != nil {
+		return err
+	}
+	for i := range pvcs.Items {
+		if _, err := refManager.ClaimPVC(ctx, &pvcs.Items[i]); err != nil {
+			return err
+		}
+	}
+	if statefulPod.Spec.PVCTemplate == nil {
+		return nil
+	}
+	pvcHandler := pvcservice.NewPVCService(pvcctrl.Client)
+	for index := 0; index < int(*statefulPod.Spec.Size); index++ {
+		var pvc corev1.PersistentVolumeClaim
+		if err := pvcctrl.Get(ctx, types.NamespacedName{
+			Namespace: statefulPod.Namespace,
+			Name:      *pvcHandler.GetName(statefulPod, index),
+		}, &pvc); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		// 有 controller 的 pvc 已在上面处理，或属于其他控制器
+		if metav1.GetControllerOf(&pvc) != nil {
+			continue
+		}
+		if _, err := refManager.ClaimPVC(ctx, &pvc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 缩容 pvc，返回 pvc 是否删除完毕
+func (pvcctrl *PVCCtrl) ShrinkPVC(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, error) {
 	pvcHandler := pvcservice.NewPVCService(pvcctrl.Client)
 	pvcName := pvcHandler.GetName(statefulPod, index)
 	if pvc, ok := pvcHandler.IsExists(ctx, types.NamespacedName{
@@ -114,13 +246,30 @@ func (pvcctrl *PVCCtrl) ShrinkPVC(ctx context.Context, statefulPod *iapetosapiv1
 		Name:      *pvcName,
 	}); ok { // pvc 存在，删除 pvc
 		if err := pvcHandler.Delete(ctx, pvc); err != nil {
-			return false
+			services.RecordEvent(pvcctrl.recorder, statefulPod, pvc.(*corev1.PersistentVolumeClaim), corev1.EventTypeWarning, services.EventFailedDelete, "delete pvc %v failed: %v", *pvcName, err)
+			return false, err
+		}
+		if pvc.(*corev1.PersistentVolumeClaim).DeletionTimestamp.IsZero() {
+			services.RecordEvent(pvcctrl.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventSuccessfulDelete, "delete pvc %v", *pvcName)
 		}
 		// pvc 删除成功
 	} else {
-		return true
+		// 播种快照、替换快照随成员一起删除，再次扩容时重新创建
+		snapshotHandler := snapshotservice.NewSnapshotService(pvcctrl.Client)
+		if seedSnapshot, ok := snapshotHandler.IsExists(ctx, types.NamespacedName{
+			Namespace: statefulPod.Namespace,
+			Name:      pvcservice.SeedSnapshotName(statefulPod, index),
+		}); ok {
+			if err := snapshotHandler.Delete(ctx, seedSnapshot); err != nil {
+				return false, err
+			}
+		}
+		if _, err := pvcctrl.deleteFailoverSnapshot(ctx, statefulPod, index); err != nil {
+			return false, err
+		}
+		return true, nil
 	}
-	return false
+	return false, nil
 }
 
 func (pvcctrl *PVCCtrl) MonitorPVCStatus(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pvc *corev1.PersistentVolumeClaim, index int) bool {
@@ -131,14 +280,14 @@ func (pvcctrl *PVCCtrl) MonitorPVCStatus(ctx context.Context, statefulPod *iapet
 		if statefulPod.Status.PVCStatusMes[index].Status == Deleting || statefulPod.Status.PodStatusMes[index].Status == CreateTimeOut {
 			return false
 		}
-		statefulPod.Status.PVCStatusMes[index].Status = Deleting
+		services.SetPVCPhase(&statefulPod.Status.PVCStatusMes[index], Deleting, iapetosapiv1.ReasonPVCTerminating, fmt.Sprintf("pvc %v is terminating", pvc.Name))
 		return true
 	}
 	if pvc.Status.Phase == corev1.ClaimBound {
 		if statefulPod.Status.PVCStatusMes[index].Status == corev1.ClaimBound {
 			return false
 		}
-		statefulPod.Status.PVCStatusMes[index].Status = corev1.ClaimBound
+		services.SetPVCPhase(&statefulPod.Status.PVCStatusMes[index], corev1.ClaimBound, "", "")
 		capicity := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
 		statefulPod.Status.PVCStatusMes[index].Capacity = capicity.String()
 		statefulPod.Status.PVCStatusMes[index].PVName = pvc.Spec.VolumeName
@@ -146,3 +295,231 @@ func (pvcctrl *PVCCtrl) MonitorPVCStatus(ctx context.Context, statefulPod *iapet
 	}
 	return false
 }
+
+// node 失联替换成员时按 failoverVolumePolicy 处理 pvc
+// 返回 statefulPod 是否需要更新，以及 pvc 是否处理完毕；出错时 statefulPod 仍可能需要更新
+func (pvcctrl *PVCCtrl) FailoverPVC(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, bool, error) {
+	if statefulPod.Spec.PVCTemplate == nil || index >= len(statefulPod.Status.PVCStatusMes) {
+		return false, true, nil
+	}
+	pvcHandler := pvcservice.NewPVCService(pvcctrl.Client)
+	obj, ok := pvcHandler.IsExists(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      *pvcHandler.GetName(statefulPod, index),
+	})
+	switch statefulPod.Spec.FailoverVolumePolicy {
+	case iapetosapiv1.FailoverVolumeReattach:
+		// 保留 pvc，由替代 pod 重新挂载
+		return false, true, nil
+	case iapetosapiv1.FailoverVolumeSnapshotThenRecreate:
+		if ok {
+			pvc := obj.(*corev1.PersistentVolumeClaim)
+			changed, ready, err := pvcctrl.snapshotPVC(ctx, statefulPod, pvc, index)
+			if err != nil || !ready {
+				return changed, false, err
+			}
+			// 隔离 pv 时可能已更新 statefulPod.Status.QuarantinedVolumes
+			if err := pvcctrl.deletePVC(ctx, statefulPod, pvc, index, iapetosapiv1.ReasonNodeLost, true); err != nil {
+				return true, false, err
+			}
+		}
+		services.SetPVCPhase(&statefulPod.Status.PVCStatusMes[index], Deleting, iapetosapiv1.ReasonNodeLost, "node is lost, pvc is being recreated")
+		return true, true, nil
+	default:
+		if ok {
+			if err := pvcctrl.deletePVC(ctx, statefulPod, obj.(*corev1.PersistentVolumeClaim), index, iapetosapiv1.ReasonNodeLost, true); err != nil {
+				return true, false, err
+			}
+		}
+		services.SetPVCPhase(&statefulPod.Status.PVCStatusMes[index], Deleting, iapetosapiv1.ReasonNodeLost, "node is lost, pvc is being recreated")
+		statefulPod.Status.PVCStatusMes[index].DataSource = pvcctrl.recoveryDataSource(ctx, statefulPod, index)
+		return true, true, nil
+	}
+}
+
+// 按 spec.recoveryPolicy 选择替代 pvc 的数据源，没有可用的数据源时返回 nil
+func (pvcctrl *PVCCtrl) recoveryDataSource(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) *corev1.TypedLocalObjectReference {
+	switch statefulPod.Spec.RecoveryPolicy {
+	case iapetosapiv1.RecoveryLatestSnapshot:
+		if name := backupservice.LatestSnapshot(ctx, pvcctrl.Client, statefulPod, index); name != "" {
+			return snapshotservice.DataSource(name)
+		}
+	case iapetosapiv1.RecoveryHealthyPeer:
+		// 克隆 pod 正常运行且 pvc 已绑定的成员
+		for i, podStatus := range statefulPod.Status.PodStatusMes {
+			if i == index || i >= len(statefulPod.Status.PVCStatusMes) {
+				continue
+			}
+			if podStatus.Status == corev1.PodRunning && statefulPod.Status.PVCStatusMes[i].Status == corev1.ClaimBound {
+				return &corev1.TypedLocalObjectReference{
+					Kind: "PersistentVolumeClaim",
+					Name: statefulPod.Status.PVCStatusMes[i].PVCName,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 替代成员的 pvc 需要恢复数据时，先创建 pvc，等待 pvc 绑定（数据恢复完成）后再创建 pod
+// pvc 要等待 pod 调度后才绑定时不等待
+func (pvcctrl *PVCCtrl) IsPVCRestored(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, error) {
+	if statefulPod.Spec.PVCTemplate == nil || index >= len(statefulPod.Status.PVCStatusMes) || statefulPod.Status.PVCStatusMes[index].DataSource == nil {
+		return true, nil
+	}
+	pvcHandler := pvcservice.NewPVCService(pvcctrl.Client)
+	pvcName := pvcHandler.GetName(statefulPod, index)
+	obj, ok := pvcHandler.IsExists(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      *pvcName,
+	})
+	if !ok {
+		pvcTemplate := pvcHandler.CreateTemplate(ctx, statefulPod, *pvcName, index).(*corev1.PersistentVolumeClaim)
+		if services.NewResource(pvcctrl.Client).IsWaitForFirstConsumer(ctx, pvcTemplate.Spec.StorageClassName) {
+			return true, nil
+		}
+		if _, err := pvcHandler.Create(ctx, pvcTemplate); err != nil {
+			// 已创建时等待 cache 同步
+			if apierrors.IsAlreadyExists(err) {
+				return false, nil
+			}
+			services.RecordEvent(pvcctrl.recorder, statefulPod, nil, corev1.EventTypeWarning, services.EventFailedCreate, "create pvc %v failed: %v", *pvcName, err)
+			return false, err
+		}
+		services.RecordEvent(pvcctrl.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventSuccessfulCreate, "create pvc %v from %v %v", *pvcName, pvcTemplate.Spec.DataSource.Kind, pvcTemplate.Spec.DataSource.Name)
+		return false, nil
+	}
+	pvc := obj.(*corev1.PersistentVolumeClaim)
+	if pvc.Status.Phase == corev1.ClaimBound || !pvc.DeletionTimestamp.IsZero() {
+		return true, nil
+	}
+	return services.NewResource(pvcctrl.Client).IsWaitForFirstConsumer(ctx, pvc.Spec.StorageClassName), nil
+}
+
+// 为 pvc 创建快照，并记录为替代 pvc 的数据源
+// 快照名称由 pvc 确定，status 更新失败后重试时使用同一个快照，不会重复创建
+// 返回 statefulPod 是否需要更新，以及快照是否可以使用
+func (pvcctrl *PVCCtrl) snapshotPVC(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pvc *corev1.PersistentVolumeClaim, index int) (bool, bool, error) {
+	snapshotHandler := snapshotservice.NewSnapshotService(pvcctrl.Client)
+	name := snapshotservice.FailoverName(pvc)
+	ready := false
+	if obj, ok := snapshotHandler.IsExists(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      name,
+	}); ok {
+		ready = snapshotservice.IsReadyToUse(obj.(*unstructured.Unstructured))
+	} else if _, err := snapshotHandler.Create(ctx, snapshotservice.FailoverTemplate(statefulPod, pvc, index)); err != nil && !apierrors.IsAlreadyExists(err) {
+		services.RecordEvent(pvcctrl.recorder, statefulPod, pvc, corev1.EventTypeWarning, services.EventFailedCreate, "create volumeSnapshot %v failed: %v", name, err)
+		return false, false, err
+	}
+	if dataSource := statefulPod.Status.PVCStatusMes[index].DataSource; snapshotservice.IsSnapshotDataSource(dataSource) && dataSource.Name == name {
+		return false, ready, nil
+	}
+	statefulPod.Status.PVCStatusMes[index].DataSource = snapshotservice.DataSource(name)
+	return true, ready, nil
+}
+
+// 替代 pvc 绑定（数据恢复完成）后删除替换成员时创建的快照，并清除 pvc 记录的数据源
+// 返回 statefulPod 是否需要更新，出错时 statefulPod 仍可能需要更新
+func (pvcctrl *PVCCtrl) CleanFailoverSnapshot(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, error) {
+	if statefulPod.Spec.PVCTemplate == nil {
+		return false, nil
+	}
+	pvcHandler := pvcservice.NewPVCService(pvcctrl.Client)
+	changed := false
+	for i, pvcStatus := range statefulPod.Status.PVCStatusMes {
+		if pvcStatus.Status != corev1.ClaimBound || !snapshotservice.IsSnapshotDataSource(pvcStatus.DataSource) {
+			continue
+		}
+		// 快照可用前原 pvc 仍处于绑定状态，只处理从该快照创建的 pvc
+		obj, ok := pvcHandler.IsExists(ctx, types.NamespacedName{
+			Namespace: statefulPod.Namespace,
+			Name:      pvcStatus.PVCName,
+		})
+		if !ok {
+			continue
+		}
+		pvc := obj.(*corev1.PersistentVolumeClaim)
+		if pvc.Status.Phase != corev1.ClaimBound || pvc.Spec.DataSource == nil || pvc.Spec.DataSource.Name != pvcStatus.DataSource.Name {
+			continue
+		}
+		cleared, err := pvcctrl.deleteFailoverSnapshot(ctx, statefulPod, i)
+		if cleared {
+			changed = true
+		}
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// 删除 index 对应 pvc 数据源中的替换快照，快照已不存在时同样清除数据源，避免重建 pvc 时引用不存在的快照
+// 返回 pvc 记录的数据源是否已清除
+func (pvcctrl *PVCCtrl) deleteFailoverSnapshot(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (bool, error) {
+	if index >= len(statefulPod.Status.PVCStatusMes) {
+		return false, nil
+	}
+	dataSource := statefulPod.Status.PVCStatusMes[index].DataSource
+	if !snapshotservice.IsSnapshotDataSource(dataSource) {
+		return false, nil
+	}
+	snapshotHandler := snapshotservice.NewSnapshotService(pvcctrl.Client)
+	if obj, ok := snapshotHandler.IsExists(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      dataSource.Name,
+	}); ok {
+		snapshot := obj.(*unstructured.Unstructured)
+		if !snapshotservice.IsFailoverSnapshot(snapshot) {
+			return false, nil
+		}
+		if err := snapshotHandler.Delete(ctx, snapshot); err != nil {
+			services.RecordEvent(pvcctrl.recorder, statefulPod, nil, corev1.EventTypeWarning, services.EventFailedDelete, "delete volumeSnapshot %v failed: %v", dataSource.Name, err)
+			return false, err
+		}
+		services.RecordEvent(pvcctrl.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventSuccessfulDelete, "delete volumeSnapshot %v", dataSource.Name)
+	}
+	statefulPod.Status.PVCStatusMes[index].DataSource = nil
+	return true, nil
+}
+
+// 替换成员时删除其 pvc，启用隔离时先隔离 pvc 绑定的 pv
+// 出错时 statefulPod.Status.QuarantinedVolumes 可能已经更新
+func (pvcctrl *PVCCtrl) ReleasePVC(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int, reason string) error {
+	if statefulPod.Spec.PVCTemplate == nil {
+		return nil
+	}
+	pvcHandler := pvcservice.NewPVCService(pvcctrl.Client)
+	obj, ok := pvcHandler.IsExists(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      *pvcHandler.GetName(statefulPod, index),
+	})
+	if !ok {
+		return nil
+	}
+	return pvcctrl.deletePVC(ctx, statefulPod, obj.(*corev1.PersistentVolumeClaim), index, reason, false)
+}
+
+// 隔离 pv 后删除 pvc，mandatory 为 true 时立即删除
+// 替代成员的 pvc 沿用相同的名称，因此不能保留原 pvc，数据保留在隔离的 pv 上，可由新的 pvc 指定 volumeName 绑定恢复
+func (pvcctrl *PVCCtrl) deletePVC(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, pvc *corev1.PersistentVolumeClaim, index int, reason string, mandatory bool) error {
+	pvcHandler := pvcservice.NewPVCService(pvcctrl.Client)
+	if err := pvctrl.NewPodCtrl(pvcctrl.Client, pvcctrl.recorder).QuarantinePV(ctx, statefulPod, pvc, index, reason); err != nil {
+		return err
+	}
+	if !pvc.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	var err error
+	if mandatory {
+		err = client.IgnoreNotFound(pvcHandler.DeleteMandatory(ctx, pvc, statefulPod))
+	} else {
+		err = pvcHandler.Delete(ctx, pvc)
+	}
+	if err != nil {
+		services.RecordEvent(pvcctrl.recorder, statefulPod, pvc, corev1.EventTypeWarning, services.EventFailedDelete, "delete pvc %v failed: %v", pvc.Name, err)
+		return err
+	}
+	services.RecordEvent(pvcctrl.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventSuccessfulDelete, "delete pvc %v: %v", pvc.Name, reason)
+	return nil
+}
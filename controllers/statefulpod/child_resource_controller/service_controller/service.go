@@ -3,27 +3,32 @@ package service_controller
 import (
 	"context"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	"github.com/q8s-io/iapetos/services"
 	svcservice "github.com/q8s-io/iapetos/services/service"
 )
 
 type ServiceController struct {
 	client.Client
+	recorder record.EventRecorder
 }
 
 type ServiceContrlIntf interface {
-	CreateService(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) bool
+	CreateService(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, error)
 	//RemoveServiceFinalizer(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) error
 }
 
-func NewServiceController(client client.Client) ServiceContrlIntf {
-	return &ServiceController{client}
+func NewServiceController(client client.Client, recorder record.EventRecorder) ServiceContrlIntf {
+	return &ServiceController{client, recorder}
 }
 
-func (servicectl *ServiceController) CreateService(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) bool {
+// 创建 service，返回 service 是否已存在
+func (servicectl *ServiceController) CreateService(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (bool, error) {
 	svcHandle := svcservice.NewPodService(servicectl.Client)
 	serviceName := svcHandle.GetName(statefulPod, 0)
 	if _, ok := svcHandle.IsExists(ctx, types.NamespacedName{
@@ -32,10 +37,12 @@ func (servicectl *ServiceController) CreateService(ctx context.Context, stateful
 	}); !ok {
 		svcTemplate := svcHandle.CreateTemplate(ctx, statefulPod, "", 0)
 		if _, err := svcHandle.Create(ctx, svcTemplate); err != nil {
-			return false
+			services.RecordEvent(servicectl.recorder, statefulPod, nil, corev1.EventTypeWarning, services.EventFailedCreate, "create service %v failed: %v", *serviceName, err)
+			return false, err
 		}
+		services.RecordEvent(servicectl.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventSuccessfulCreate, "create service %v", *serviceName)
 	} else {
-		return true
+		return true, nil
 	}
-	return false
+	return false, nil
 }
@@ -6,37 +6,91 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	backupctrl "github.com/q8s-io/iapetos/controllers/statefulpod/child_resource_controller/backup_controller"
+	migrationctrl "github.com/q8s-io/iapetos/controllers/statefulpod/child_resource_controller/migration_controller"
 	podctrl "github.com/q8s-io/iapetos/controllers/statefulpod/child_resource_controller/pod_controller"
-	pvctrl "github.com/q8s-io/iapetoscontrollers/statefulpod/child_resource_controller/pv_controller"
+	pvctrl "github.com/q8s-io/iapetos/controllers/statefulpod/child_resource_controller/pv_controller"
 	pvcctrl "github.com/q8s-io/iapetos/controllers/statefulpod/child_resource_controller/pvc_controller"
 	svcctrl "github.com/q8s-io/iapetos/controllers/statefulpod/child_resource_controller/service_controller"
+	"github.com/q8s-io/iapetos/metrics"
+	"github.com/q8s-io/iapetos/services"
+	backupservice "github.com/q8s-io/iapetos/services/backup"
 	"github.com/q8s-io/iapetos/services/statefulpod"
 	"github.com/q8s-io/iapetos/tools"
 )
 
 const (
-	ParentNmae = "parentName"
-	WaitTime   = time.Duration(time.Second * 2)
+	WaitTime = time.Duration(time.Second * 2)
 )
 
 type StatefulPodCtrl struct {
 	client.Client
 	sync.RWMutex
+	recorder record.EventRecorder
 }
 
 type StatefulPodCtrlFunc interface {
+	Reconcile(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (ctrl.Result, error)
 	CoreCtrl(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (ctrl.Result, error)
-	MonitorPodStatus(ctx context.Context, pod *corev1.Pod) (ctrl.Result, error)
-	MonitorPVCStatus(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (ctrl.Result, error)
+	MonitorBackup(ctx context.Context, backup *iapetosapiv1.StatefulPodBackup) (ctrl.Result, error)
 }
 
-func NewStatefulPodCtrl(client client.Client) StatefulPodCtrlFunc {
-	return &StatefulPodCtrl{client, sync.RWMutex{}}
+func NewStatefulPodCtrl(client client.Client, recorder record.EventRecorder) StatefulPodCtrlFunc {
+	return &StatefulPodCtrl{client, sync.RWMutex{}, recorder}
+}
+
+// 一次处理 statefulPod 及其所有 pod、pvc：先根据 pod、pvc 的状态更新成员状态，再扩缩容、维护
+// 出错时按错误类型决定重试方式，见 handleError
+func (s *StatefulPodCtrl) Reconcile(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (ctrl.Result, error) {
+	if err := services.ValidateStatefulPod(statefulPod); err != nil {
+		return s.handleError(ctx, statefulPod, ctrl.Result{}, err)
+	}
+	monitorRequeueAfter, err := s.monitorMembers(ctx, statefulPod)
+	if err != nil {
+		return s.handleError(ctx, statefulPod, ctrl.Result{}, err)
+	}
+	result, err := s.CoreCtrl(ctx, statefulPod)
+	result.RequeueAfter = tools.MinRequeueAfter(result.RequeueAfter, monitorRequeueAfter)
+	return s.handleError(ctx, statefulPod, result, err)
+}
+
+// spec 不合法时记录到 status condition，修改 spec 前不再重试；冲突时立即重新处理；
+// 其他错误返回给 workqueue，由 rate limiter 指数退避重试
+func (s *StatefulPodCtrl) handleError(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, result ctrl.Result, err error) (ctrl.Result, error) {
+	statefulPodHandler := statefulpod.NewStatefulPod(s.Client)
+	if err == nil {
+		// spec 已修正
+		if services.RemoveCondition(&statefulPod.Status, iapetosapiv1.StatefulPodInvalidSpec) {
+			if _, err := statefulPodHandler.Update(ctx, statefulPod); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return result, nil
+	}
+	switch services.ClassifyError(err) {
+	case services.ErrorInvalidSpec:
+		if services.SetCondition(&statefulPod.Status, iapetosapiv1.StatefulPodCondition{
+			Type:    iapetosapiv1.StatefulPodInvalidSpec,
+			Status:  corev1.ConditionTrue,
+			Reason:  services.ErrorReason(err),
+			Message: err.Error(),
+		}) {
+			services.RecordEvent(s.recorder, statefulPod, nil, corev1.EventTypeWarning, services.EventInvalidSpec, "%v", err)
+			if _, err := statefulPodHandler.Update(ctx, statefulPod); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	case services.ErrorConflict:
+		return ctrl.Result{Requeue: true}, nil
+	default:
+		return ctrl.Result{}, err
+	}
 }
 
 // StatefulPod 控制器
@@ -46,21 +100,44 @@ func NewStatefulPodCtrl(client client.Client) StatefulPodCtrlFunc {
 func (s *StatefulPodCtrl) CoreCtrl(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (ctrl.Result, error) {
 	lenStatus := s.getIndex(statefulPod)
 	lenSpec := int(*statefulPod.Spec.Size)
+	metrics.UpdateMembers(statefulPod)
 	//fmt.Println("-----------lenstatus: ",lenStatus)
 	if !statefulPod.DeletionTimestamp.IsZero() && lenStatus == lenSpec {
 		//	fmt.Println("delete ------")
 		return s.deleteStatefulPod(ctx, statefulPod)
 	}
 
+	// 暂停时只处理删除
+	if statefulPod.Spec.Paused && statefulPod.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	// 迁移失败时不创建成员，避免与 StatefulSet 的 pod 冲突
+	if migration := statefulPod.Status.Migration; migration != nil && migration.Phase == iapetosapiv1.MigrationFailed && statefulPod.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	// 从 StatefulSet 迁移
+	migrationChanged, migrationRequeueAfter, err := migrationctrl.NewMigrationCtrl(s.Client, s.recorder).Migrate(ctx, statefulPod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if migrationChanged {
+		if _, err := statefulpod.NewStatefulPod(s.Client).Update(ctx, statefulPod); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: migrationRequeueAfter}, nil
+	}
+
 	if lenStatus < lenSpec {
 		return s.expansion(ctx, statefulPod, lenStatus)
 	} else if lenStatus > lenSpec {
 		return s.shrink(ctx, statefulPod, lenStatus)
 	} else {
 		if result, err := s.setFinalizer(ctx, statefulPod); err != nil {
-			return result, nil
+			return result, err
 		}
-		return s.maintain(ctx, statefulPod)
+		result, err := s.maintain(ctx, statefulPod)
+		result.RequeueAfter = tools.MinRequeueAfter(result.RequeueAfter, migrationRequeueAfter)
+		return result, err
 	}
 }
 
@@ -72,6 +149,10 @@ func (s *StatefulPodCtrl) getIndex(statefulPod *iapetosapiv1.StatefulPod) int {
 	if statefulPod.Status.PodStatusMes[index].Status == corev1.PodPhase("CreateTimeOut") {
 		return index
 	}
+	// 迁移中的成员已经存在
+	if statefulPod.Status.PodStatusMes[index].Status == podctrl.Migrating {
+		return index + 1
+	}
 	// 只有在扩容时才会 index-1，若是所容不管 pod 是不是 running 状态
 	if statefulPod.Status.PodStatusMes[index].Status == corev1.PodPhase("Preparing") && index<int(*statefulPod.Spec.Size){
 		return index
@@ -84,34 +165,36 @@ func (s *StatefulPodCtrl) getIndex(statefulPod *iapetosapiv1.StatefulPod) int {
 
 func (s *StatefulPodCtrl) deleteStatefulPod(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (ctrl.Result, error) {
 	statefulPodHandler := statefulpod.NewStatefulPod(s.Client)
-	pvCtrl := pvctrl.NewPodCtrl(s.Client)
+	pvCtrl := pvctrl.NewPodCtrl(s.Client, s.recorder)
 	myFinalizerName := iapetosapiv1.GroupVersion.String()
 	// 删除 statefulPod
 	if tools.MatchStringFromArray(statefulPod.Finalizers, myFinalizerName) {
 		// 删除 pod、pvc
 		// 设置所有pv为Retain
-		if !pvCtrl.SetPVRetain(ctx, statefulPod) {
-			return ctrl.Result{RequeueAfter: WaitTime}, nil
+		// 出错时返回错误由 workqueue 退避重试，未完成时等待后重新检查
+		if ok, err := pvCtrl.SetPVRetain(ctx, statefulPod); err != nil || !ok {
+			return ctrl.Result{RequeueAfter: WaitTime}, err
 		}
 		// 删除所有pod
-		if !podctrl.NewPodCtrl(s.Client).DeletePodAll(ctx, statefulPod) {
-			return ctrl.Result{RequeueAfter: WaitTime}, nil
+		if ok, err := podctrl.NewPodCtrl(s.Client, s.recorder).DeletePodAll(ctx, statefulPod); err != nil || !ok {
+			return ctrl.Result{RequeueAfter: WaitTime}, err
 		}
 		// 删除所有pvc
 		//fmt.Println("----begin delete pvc -------")
-		if !pvcctrl.NewPVCCtrl(s.Client).DeletePvcAll(ctx, statefulPod) {
-			return ctrl.Result{RequeueAfter: WaitTime}, nil
+		if ok, err := pvcctrl.NewPVCCtrl(s.Client, s.recorder).DeletePvcAll(ctx, statefulPod); err != nil || !ok {
+			return ctrl.Result{RequeueAfter: WaitTime}, err
 		}
 		// 将所有pv置为Available
-		if !pvCtrl.SetPVAvailable(ctx, statefulPod) {
-			return ctrl.Result{RequeueAfter: WaitTime}, nil
+		if ok, err := pvCtrl.SetPVAvailable(ctx, statefulPod); err != nil || !ok {
+			return ctrl.Result{RequeueAfter: WaitTime}, err
 		}
+		// 隔离的 pv 保持 Retain 以及隔离的 label、annotation，不随 statefulPod 删除
 		statefulPod.Finalizers = tools.RemoveString(statefulPod.Finalizers, myFinalizerName)
 		if _, err := statefulPodHandler.Update(ctx, statefulPod); err != nil {
-			return ctrl.Result{
-				RequeueAfter: WaitTime,
-			}, nil
+			return ctrl.Result{}, err
 		}
+		services.RecordEvent(s.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventFinalizerRemoved, "members deleted, finalizer removed")
+		metrics.DeleteStatefulPod(statefulPod)
 	}
 	return ctrl.Result{}, nil
 }
@@ -125,25 +208,35 @@ func (s *StatefulPodCtrl) expansion(ctx context.Context, statefulPod *iapetosapi
 	var podStatus *iapetosapiv1.PodStatus
 	var pvcStatus *iapetosapiv1.PVCStatus
 	var err error
-	serviceCtrl := svcctrl.NewServiceController(s.Client)
-	podCtrl := podctrl.NewPodCtrl(s.Client)
-	pvcCtrl := pvcctrl.NewPVCCtrl(s.Client)
+	serviceCtrl := svcctrl.NewServiceController(s.Client, s.recorder)
+	podCtrl := podctrl.NewPodCtrl(s.Client, s.recorder)
+	pvcCtrl := pvcctrl.NewPVCCtrl(s.Client, s.recorder)
 	statefulPodHandler := statefulpod.NewStatefulPod(s.Client)
 	// 索引为 0，且需要生成 service
 	if index == 0 && statefulPod.Spec.ServiceTemplate != nil {
-		if ok := serviceCtrl.CreateService(ctx, statefulPod); !ok {
+		if ok, err := serviceCtrl.CreateService(ctx, statefulPod); err != nil || !ok {
 			// 若创建，则等待5秒
 			return ctrl.Result{
 				RequeueAfter: WaitTime,
-			}, nil
+			}, err
+		}
+	}
+	// 从备份恢复或从 peer 播种时，等待数据源可用后再创建成员
+	if len(statefulPod.Status.PodStatusMes) == index {
+		if ready, err := pvcCtrl.IsDataSourceReady(ctx, statefulPod, index); err != nil || !ready {
+			return ctrl.Result{RequeueAfter: WaitTime}, err
 		}
 	}
+	// 替代成员的 pvc 需要恢复数据时，等待数据恢复完成后再创建 pod
+	if restored, err := pvcCtrl.IsPVCRestored(ctx, statefulPod, index); err != nil || !restored {
+		return ctrl.Result{RequeueAfter: WaitTime}, err
+	}
 	if podStatus, err = podCtrl.ExpansionPod(ctx, statefulPod, index); err != nil {
-		return ctrl.Result{Requeue: true}, nil
+		return ctrl.Result{}, err
 	}
 	if statefulPod.Spec.PVCTemplate != nil {
 		if pvcStatus, err = pvcCtrl.ExpansionPVC(ctx, statefulPod, index); err != nil {
-			return ctrl.Result{}, nil
+			return ctrl.Result{}, err
 		}
 	} else {
 		pvcStatus = &iapetosapiv1.PVCStatus{
@@ -154,7 +247,8 @@ func (s *StatefulPodCtrl) expansion(ctx context.Context, statefulPod *iapetosapi
 		}
 	}
 	// 等于index代表是第一次扩容，不等代表维护
-	if len(statefulPod.Status.PodStatusMes) == index {
+	added := len(statefulPod.Status.PodStatusMes) == index
+	if added {
 		statefulPod.Status.PodStatusMes = append(statefulPod.Status.PodStatusMes, *podStatus)
 		statefulPod.Status.PVCStatusMes = append(statefulPod.Status.PVCStatusMes, *pvcStatus)
 	} else {
@@ -162,9 +256,10 @@ func (s *StatefulPodCtrl) expansion(ctx context.Context, statefulPod *iapetosapi
 		statefulPod.Status.PVCStatusMes[index] = *pvcStatus
 	}
 	if _, err := statefulPodHandler.Update(ctx, statefulPod); err != nil {
-		return ctrl.Result{
-			RequeueAfter: WaitTime,
-		}, nil
+		return ctrl.Result{}, err
+	}
+	if added {
+		metrics.Expansions.WithLabelValues(statefulPod.Namespace, statefulPod.Name).Inc()
 	}
 	return ctrl.Result{}, nil
 }
@@ -172,43 +267,84 @@ func (s *StatefulPodCtrl) expansion(ctx context.Context, statefulPod *iapetosapi
 // 缩容
 // 若 pvc 存在，删除 pvc
 func (s *StatefulPodCtrl) shrink(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, index int) (ctrl.Result, error) {
-	podCtrl := podctrl.NewPodCtrl(s.Client)
-	pvcCtrl := pvcctrl.NewPVCCtrl(s.Client)
+	podCtrl := podctrl.NewPodCtrl(s.Client, s.recorder)
+	pvcCtrl := pvcctrl.NewPVCCtrl(s.Client, s.recorder)
 	statefulPodHandler := statefulpod.NewStatefulPod(s.Client)
 	// 判断 pod 是否删除完毕
-	if ok := podCtrl.ShrinkPod(ctx, statefulPod, index-1); !ok {
-		return ctrl.Result{RequeueAfter: WaitTime}, nil
+	if ok, err := podCtrl.ShrinkPod(ctx, statefulPod, index-1); err != nil || !ok {
+		return ctrl.Result{RequeueAfter: WaitTime}, err
 	}
 	// 判断 pvc 是否删除完毕,如果删除失败或者刚刚创建，等待5秒
 	if statefulPod.Spec.PVCTemplate != nil {
-		if ok := pvcCtrl.ShrinkPVC(ctx, statefulPod, index-1); !ok {
-			return ctrl.Result{RequeueAfter: WaitTime}, nil
+		if ok, err := pvcCtrl.ShrinkPVC(ctx, statefulPod, index-1); err != nil || !ok {
+			return ctrl.Result{RequeueAfter: WaitTime}, err
 		}
 	}
 	statefulPod.Status.PodStatusMes = statefulPod.Status.PodStatusMes[:index-1]
 	statefulPod.Status.PVCStatusMes = statefulPod.Status.PVCStatusMes[:index-1]
-	if _, err := statefulPodHandler.Update(ctx, statefulPod); err != nil { // 更新失败，等待5秒
-		return ctrl.Result{
-			RequeueAfter: WaitTime,
-		}, nil
+	if _, err := statefulPodHandler.Update(ctx, statefulPod); err != nil {
+		return ctrl.Result{}, err
 	}
+	metrics.Shrinks.WithLabelValues(statefulPod.Namespace, statefulPod.Name).Inc()
 	return ctrl.Result{}, nil
 }
 
 // 维护 pod 状态
 func (s *StatefulPodCtrl) maintain(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (ctrl.Result, error) {
-	podCtrl := podctrl.NewPodCtrl(s.Client)
+	podCtrl := podctrl.NewPodCtrl(s.Client, s.recorder)
+	pvCtrl := pvctrl.NewPodCtrl(s.Client, s.recorder)
 	statefulPodHandler := statefulpod.NewStatefulPod(s.Client)
+	// 认领与成员同名的孤儿 pod、pvc，释放不再匹配的 pod、pvc
+	if err := podCtrl.ClaimPods(ctx, statefulPod); err != nil {
+		return ctrl.Result{}, err
+	}
+	pvcCtrl := pvcctrl.NewPVCCtrl(s.Client, s.recorder)
+	if err := pvcCtrl.ClaimPVCs(ctx, statefulPod); err != nil {
+		return ctrl.Result{}, err
+	}
+	// 检查 pod 所在 node 是否失联，node 不健康但未超时时，在超时时间点重新检查
+	// 出错时先保存已更新的 status 再返回错误
+	nodeChanged, requeueAfter, nodeErr := podCtrl.MaintainNode(ctx, statefulPod)
+	// 清理超过保留时间的隔离 pv
+	quarantineChanged, quarantineRequeueAfter, quarantineErr := pvCtrl.CleanQuarantinedPV(ctx, statefulPod)
+	requeueAfter = tools.MinRequeueAfter(requeueAfter, quarantineRequeueAfter)
+	// 删除替代 pvc 已恢复完成的替换快照
+	snapshotChanged, snapshotErr := pvcCtrl.CleanFailoverSnapshot(ctx, statefulPod)
+	// 按计划创建备份，在下一次备份时间点重新检查
+	backupChanged, backupRequeueAfter := backupctrl.NewBackupCtrl(s.Client, s.recorder).ScheduleBackup(ctx, statefulPod)
+	requeueAfter = tools.MinRequeueAfter(requeueAfter, backupRequeueAfter)
 	// 检查pod是否有没有意外退出的，若有，则将其在statefulPod status的索引位置置为deleting ,若pod存在，状态为running，而statefulPod中记录的不是也返回索引值
-	if index := podCtrl.PodIsOk(ctx, statefulPod); index != nil {
+	if index := podCtrl.PodIsOk(ctx, statefulPod); index != nil || nodeChanged || quarantineChanged || snapshotChanged || backupChanged {
 		if _, err := statefulPodHandler.Update(ctx, statefulPod); err != nil {
-			return ctrl.Result{RequeueAfter: WaitTime}, nil
+			return ctrl.Result{}, err
 		}
 	}
+	if nodeErr != nil {
+		return ctrl.Result{}, nodeErr
+	}
+	// 清理隔离 pv、替换快照失败不影响成员的维护，最后返回错误
+	cleanErr := quarantineErr
+	if cleanErr == nil {
+		cleanErr = snapshotErr
+	}
 	if index := podCtrl.MaintainPod(ctx, statefulPod); index != nil {
-		return s.expansion(ctx, statefulPod, *index)
+		result, err := s.expansion(ctx, statefulPod, *index)
+		if err == nil {
+			err = cleanErr
+		}
+		return result, err
 	}
-	return ctrl.Result{}, nil
+	// 滚动重启
+	restartChanged, restartRequeueAfter, err := podCtrl.RollingRestart(ctx, statefulPod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if restartChanged {
+		if _, err := statefulPodHandler.Update(ctx, statefulPod); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{RequeueAfter: tools.MinRequeueAfter(requeueAfter, restartRequeueAfter)}, cleanErr
 }
 
 // 设置 statefulPod finalizer
@@ -219,54 +355,73 @@ func (s *StatefulPodCtrl) setFinalizer(ctx context.Context, statefulPod *iapetos
 		if !tools.MatchStringFromArray(statefulPod.Finalizers, myFinalizerName) { // finalizer未设置，则添加finalizer
 			statefulPod.Finalizers = append(statefulPod.Finalizers, myFinalizerName)
 			if _, err := statefulPodHandler.Update(ctx, statefulPod); err != nil {
-				return ctrl.Result{RequeueAfter: WaitTime}, err
+				return ctrl.Result{}, err
 			}
+			services.RecordEvent(s.recorder, statefulPod, nil, corev1.EventTypeNormal, services.EventFinalizerAdded, "finalizer %v added", myFinalizerName)
 		}
 	}
 	return ctrl.Result{}, nil
 }
 
-// 处理 pod 不同的 status
+// 处理 pod、pvc 不同的 status
 // pod 异常退出，重新拉起 pod
 // node 节点失联，新建 pod、pvc
 // pod running 状态，修改 statefulPod.status.PodStatusMes
-func (s *StatefulPodCtrl) MonitorPodStatus(ctx context.Context, pod *corev1.Pod) (ctrl.Result, error) {
-	statefulPodHandler := statefulpod.NewStatefulPod(s.Client)
-	obj, ok := statefulPodHandler.IsExists(ctx, types.NamespacedName{
-		Namespace: pod.Namespace,
-		Name:      pod.Annotations[ParentNmae],
-	})
-	if !ok {
-		return ctrl.Result{}, nil
+// pvc bound 状态，修改 statefulPod.status.PVCStatusMes
+// 返回重新检查的时间
+func (s *StatefulPodCtrl) monitorMembers(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) (time.Duration, error) {
+	// statefulPod 的 pod、pvc 通过 controller ownerReference 索引
+	owned := client.MatchingFields{services.ControllerUIDField: string(statefulPod.UID)}
+	var pods corev1.PodList
+	if err := s.List(ctx, &pods, client.InNamespace(statefulPod.Namespace), owned); err != nil {
+		return 0, err
 	}
-	statefulPod := obj.(*iapetosapiv1.StatefulPod)
-	index := tools.StringToInt(pod.Annotations["index"])
-	podctl := podctrl.NewPodCtrl(s.Client)
-	if ok := podctl.MonitorPodStatus(ctx, statefulPod, pod, &index); ok {
-		if _, err := statefulPodHandler.Update(ctx, statefulPod); err != nil {
-			return ctrl.Result{RequeueAfter: WaitTime}, nil
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := s.List(ctx, &pvcs, client.InNamespace(statefulPod.Namespace), owned); err != nil {
+		return 0, err
+	}
+	changed := false
+	var requeueAfter time.Duration
+	// 某个 pod 处理出错时继续处理其他成员，保存 status 后返回第一个错误
+	var podErr error
+	// 暂停时不处理 pod
+	if !statefulPod.Spec.Paused {
+		podctl := podctrl.NewPodCtrl(s.Client, s.recorder)
+		for i := range pods.Items {
+			index := tools.StringToInt(pods.Items[i].Annotations[services.Index])
+			podChanged, podRequeueAfter, err := podctl.MonitorPodStatus(ctx, statefulPod, &pods.Items[i], &index)
+			if err != nil && podErr == nil {
+				podErr = err
+			}
+			changed = podChanged || changed
+			requeueAfter = tools.MinRequeueAfter(requeueAfter, podRequeueAfter)
 		}
 	}
-	return ctrl.Result{}, nil
+	pvcCtrl := pvcctrl.NewPVCCtrl(s.Client, s.recorder)
+	for i := range pvcs.Items {
+		index := tools.StringToInt(pvcs.Items[i].Annotations[services.Index])
+		changed = pvcCtrl.MonitorPVCStatus(ctx, statefulPod, &pvcs.Items[i], index) || changed
+	}
+	if changed {
+		if _, err := statefulpod.NewStatefulPod(s.Client).Update(ctx, statefulPod); err != nil {
+			return 0, err
+		}
+	}
+	return requeueAfter, podErr
 }
 
-// 处理 pvc 不同的 status
-func (s *StatefulPodCtrl) MonitorPVCStatus(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (ctrl.Result, error) {
-	statefulPodHandler := statefulpod.NewStatefulPod(s.Client)
-	obj, ok := statefulPodHandler.IsExists(ctx, types.NamespacedName{
-		Namespace: pvc.Namespace,
-		Name:      pvc.Annotations[ParentNmae],
-	})
-	if !ok {
-		return ctrl.Result{}, nil
-	}
-	statefulPod := obj.(*iapetosapiv1.StatefulPod)
-	index := tools.StringToInt(pvc.Annotations["index"])
-	pvcCtrl := pvcctrl.NewPVCCtrl(s.Client)
-	if ok := pvcCtrl.MonitorPVCStatus(ctx, statefulPod, pvc, index); ok {
-		if _, err := statefulPodHandler.Update(ctx, statefulPod); err != nil {
-			return ctrl.Result{RequeueAfter: WaitTime}, nil
+// 创建 backup 的成员快照，并等待快照可用
+func (s *StatefulPodCtrl) MonitorBackup(ctx context.Context, backup *iapetosapiv1.StatefulPodBackup) (ctrl.Result, error) {
+	backupHandler := backupservice.NewBackupService(s.Client)
+	changed, requeueAfter := backupctrl.NewBackupCtrl(s.Client, s.recorder).RunBackup(ctx, backup)
+	if changed {
+		if _, err := backupHandler.Update(ctx, backup); err != nil {
+			// 冲突时立即重新处理
+			if services.ClassifyError(err) == services.ErrorConflict {
+				return ctrl.Result{Requeue: true}, nil
+			}
+			return ctrl.Result{}, err
 		}
 	}
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
@@ -22,28 +22,38 @@ import (
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
 	statefulpodctrl "github.com/q8s-io/iapetos/controllers/statefulpod"
-)
-
-const (
-	Pod         = "Pod"
-	PVC         = "PVC"
-	StatefulPod = "StatefulPod"
-	UNKNOWN     = "UNKNOWN"
+	"github.com/q8s-io/iapetos/health"
+	"github.com/q8s-io/iapetos/services"
+	"github.com/q8s-io/iapetos/shard"
 )
 
 // StatefulPodReconciler reconciles a StatefulPod object
 type StatefulPodReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// 并发数，未设置时为 3；请求以 statefulPod 为 key，workqueue 保证同一个 statefulPod 同时只由一个 worker 处理
+	MaxConcurrentReconciles int
+	// 记录执行中的 reconcile，用于存活检查
+	Watchdog *health.Watchdog
+	// 只处理属于当前分片的 statefulPod
+	ShardSelector labels.Selector
+	// 配置重新加载的通知，为空时不监听
+	ConfigReloaded <-chan event.GenericEvent
 	sync.RWMutex
 	watchs    chan struct{}
 	deleteEnd chan struct{}
@@ -55,45 +65,66 @@ type StatefulPodReconciler struct {
 // +kubebuilder:rbac:groups=core,resources=persistentvolume/status,verbs=get
 // +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get
 // +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims/status,verbs=get
+// +kubebuilder:rbac:groups=core,resources=persistentvolumes,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=volumeattachments,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;update;delete
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch
 func (r *StatefulPodReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	defer r.Watchdog.Track("statefulpod/" + req.String())()
 	ctx := context.Background()
-	switch obj, kind := r.getType(ctx, req); kind {
-	case Pod:
-		pod := obj.(*corev1.Pod)
-		return statefulpodctrl.NewStatefulPodCtrl(r.Client).MonitorPodStatus(ctx, pod)
-	case PVC:
-		pvc := obj.(*corev1.PersistentVolumeClaim)
-		return statefulpodctrl.NewStatefulPodCtrl(r.Client).MonitorPVCStatus(ctx, pvc)
-	case StatefulPod:
-		statefulPod := obj.(*iapetosapiv1.StatefulPod)
-		return statefulpodctrl.NewStatefulPodCtrl(r.Client).CoreCtrl(ctx, statefulPod)
+	var statefulPod iapetosapiv1.StatefulPod
+	if err := r.Get(ctx, req.NamespacedName, &statefulPod); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
-	return ctrl.Result{}, nil
+	if !shard.Contains(r.ShardSelector, &statefulPod) {
+		return ctrl.Result{}, nil
+	}
+	return statefulpodctrl.NewStatefulPodCtrl(r.Client, r.Recorder).Reconcile(ctx, &statefulPod)
 }
 
 func (r *StatefulPodReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).For(&iapetosapiv1.StatefulPod{}).
-		Watches(&source.Kind{Type: &corev1.Pod{}}, &StatefulPodEvent{}).
-		Watches(&source.Kind{Type: &corev1.PersistentVolumeClaim{}}, &StatefulPodEvent{}).
-		WithEventFilter(StatefulPodPredicate{}).
+	if err := mgr.GetFieldIndexer().IndexField(&corev1.Pod{}, NodeNameField, IndexPodNodeName); err != nil {
+		return err
+	}
+	// statefulPod 按成员名称前缀建立索引，孤儿 pod、pvc 只与同名前缀的 statefulPod 匹配
+	if err := mgr.GetFieldIndexer().IndexField(&iapetosapiv1.StatefulPod{}, services.MemberPrefixField, services.IndexMemberPrefix); err != nil {
+		return err
+	}
+	// pod、pvc 按 controller 建立索引，用于查找 statefulPod 的所有 pod、pvc
+	for _, child := range []runtime.Object{&corev1.Pod{}, &corev1.PersistentVolumeClaim{}} {
+		if err := mgr.GetFieldIndexer().IndexField(child, services.ControllerUIDField, services.IndexControllerUID); err != nil {
+			return err
+		}
+	}
+	if r.MaxConcurrentReconciles == 0 {
+		r.MaxConcurrentReconciles = 3
+	}
+	builder := ctrl.NewControllerManagedBy(mgr).For(&iapetosapiv1.StatefulPod{}).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: ChildMapper{mgr.GetClient()}}).
+		Watches(&source.Kind{Type: &corev1.PersistentVolumeClaim{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: ChildMapper{mgr.GetClient()}}).
+		Watches(&source.Kind{Type: &corev1.Node{}}, &NodeEvent{mgr.GetClient()})
+	if r.ConfigReloaded != nil {
+		builder = builder.Watches(&source.Channel{Source: r.ConfigReloaded}, &ConfigEvent{mgr.GetClient(), r.ShardSelector})
+	}
+	return builder.WithEventFilter(StatefulPodPredicate{}).
 		WithOptions(controller.Options{
-			MaxConcurrentReconciles: 3,
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
 		}).
 		Complete(r)
 }
 
-func (r *StatefulPodReconciler) getType(ctx context.Context, req ctrl.Request) (interface{}, string) {
-	var pod corev1.Pod
-	var pvc corev1.PersistentVolumeClaim
-	var statefulPod iapetosapiv1.StatefulPod
-	if err := r.Get(ctx, req.NamespacedName, &statefulPod); err == nil {
-		return &statefulPod, StatefulPod
-	}
-	if err := r.Get(ctx, req.NamespacedName, &pod); err == nil {
-		return &pod, Pod
+// backup 所属的 statefulPod 是否属于当前分片，statefulPod 不存在时无需处理
+func inShard(ctx context.Context, c client.Client, selector labels.Selector, namespace, name string) bool {
+	if selector == nil || selector.Empty() {
+		return true
 	}
-	if err := r.Get(ctx, req.NamespacedName, &pvc); err == nil {
-		return &pvc, PVC
+	var statefulPod iapetosapiv1.StatefulPod
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &statefulPod); err != nil {
+		return false
 	}
-	return nil, UNKNOWN
+	return shard.Contains(selector, &statefulPod)
 }
@@ -0,0 +1,63 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	statefulpodctrl "github.com/q8s-io/iapetos/controllers/statefulpod"
+	"github.com/q8s-io/iapetos/health"
+)
+
+// StatefulPodBackupReconciler reconciles a StatefulPodBackup object
+type StatefulPodBackupReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Watchdog *health.Watchdog
+	// 只处理属于当前分片的 statefulPod 的 backup
+	ShardSelector labels.Selector
+}
+
+// +kubebuilder:rbac:groups=iapetos.foundary-cloud.io,resources=statefulpodbackups,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=iapetos.foundary-cloud.io,resources=statefulpodbackups/status,verbs=get;update;patch
+func (r *StatefulPodBackupReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	defer r.Watchdog.Track("statefulpodbackup/" + req.String())()
+	ctx := context.Background()
+	var backup iapetosapiv1.StatefulPodBackup
+	if err := r.Get(ctx, req.NamespacedName, &backup); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !inShard(ctx, r.Client, r.ShardSelector, backup.Namespace, backup.Spec.StatefulPodName) {
+		return ctrl.Result{}, nil
+	}
+	return statefulpodctrl.NewStatefulPodCtrl(r.Client, r.Recorder).MonitorBackup(ctx, &backup)
+}
+
+func (r *StatefulPodBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).For(&iapetosapiv1.StatefulPodBackup{}).
+		Complete(r)
+}
@@ -7,11 +7,17 @@ require (
 	github.com/go-logr/logr v0.1.0
 	github.com/onsi/ginkgo v1.11.0
 	github.com/onsi/gomega v1.8.1
+	github.com/prometheus/client_golang v1.0.0
+	github.com/prometheus/client_golang v1.0.0
 	github.com/prometheus/common v0.4.1
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/spf13/pflag v1.0.5
+	go.uber.org/zap v1.10.0
 	k8s.io/api v0.17.12
 	k8s.io/apimachinery v0.17.12
 	k8s.io/client-go v0.17.12
 	sigs.k8s.io/controller-runtime v0.5.0
+	sigs.k8s.io/yaml v1.1.0
 )
 
 replace github.com/q8s-io/iapetos => ../
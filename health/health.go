@@ -0,0 +1,113 @@
+// manager 的 healthz、readyz 检查：缓存同步与选主状态决定是否就绪，reconcile 卡死时存活检查失败
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// 缓存同步完成后就绪，实现 manager.Runnable
+type CacheSyncCheck struct {
+	cache  cache.Cache
+	synced int32
+}
+
+func NewCacheSyncCheck(cache cache.Cache) *CacheSyncCheck {
+	return &CacheSyncCheck{cache: cache}
+}
+
+func (c *CacheSyncCheck) Start(stop <-chan struct{}) error {
+	if c.cache.WaitForCacheSync(stop) {
+		atomic.StoreInt32(&c.synced, 1)
+	}
+	return nil
+}
+
+// 所有副本都需要同步缓存，不参与选主
+func (c *CacheSyncCheck) NeedLeaderElection() bool {
+	return false
+}
+
+func (c *CacheSyncCheck) Check(_ *http.Request) error {
+	if atomic.LoadInt32(&c.synced) == 0 {
+		return errors.New("informer caches are not synced")
+	}
+	return nil
+}
+
+// 成为 leader 后就绪，未开启选主时随 manager 启动即就绪，实现 manager.Runnable
+type LeaderCheck struct {
+	elected int32
+}
+
+func NewLeaderCheck() *LeaderCheck {
+	return &LeaderCheck{}
+}
+
+// 只有选主成功后 manager 才会启动需要选主的 runnable
+func (l *LeaderCheck) Start(_ <-chan struct{}) error {
+	atomic.StoreInt32(&l.elected, 1)
+	return nil
+}
+
+func (l *LeaderCheck) NeedLeaderElection() bool {
+	return true
+}
+
+func (l *LeaderCheck) Check(_ *http.Request) error {
+	if atomic.LoadInt32(&l.elected) == 0 {
+		return errors.New("not the leader")
+	}
+	return nil
+}
+
+// 记录正在执行的 reconcile，执行时间超过 timeout 时视为卡死，存活检查失败
+// 例如 StatefulPodService.Update 在冲突时不断重试
+type Watchdog struct {
+	sync.Mutex
+	timeout  time.Duration
+	inflight map[string]time.Time
+}
+
+func NewWatchdog(timeout time.Duration) *Watchdog {
+	return &Watchdog{timeout: timeout, inflight: make(map[string]time.Time)}
+}
+
+// 开始一次 reconcile，返回结束时调用的函数；workqueue 保证同一个 key 不会被并发处理
+func (w *Watchdog) Track(key string) func() {
+	if w == nil {
+		return func() {}
+	}
+	w.Lock()
+	defer w.Unlock()
+	w.inflight[key] = time.Now()
+	return func() {
+		w.Lock()
+		defer w.Unlock()
+		delete(w.inflight, key)
+	}
+}
+
+func (w *Watchdog) Check(_ *http.Request) error {
+	w.Lock()
+	defer w.Unlock()
+	var stuck []string
+	for key, start := range w.inflight {
+		if elapsed := time.Since(start); elapsed > w.timeout {
+			stuck = append(stuck, fmt.Sprintf("%v (%v)", key, elapsed.Round(time.Second)))
+		}
+	}
+	if len(stuck) != 0 {
+		sort.Strings(stuck)
+		return fmt.Errorf("reconcile running longer than %v: %v", w.timeout, strings.Join(stuck, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package health
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	watchdog := NewWatchdog(time.Minute)
+	done := watchdog.Track("statefulpod/default/sp")
+	if err := watchdog.Check(nil); err != nil {
+		t.Fatalf("Check() = %v; want nil for a recent reconcile", err)
+	}
+
+	// 超过 timeout 仍未结束的 reconcile 视为卡死
+	watchdog.inflight["statefulpod/default/sp"] = time.Now().Add(-time.Hour)
+	if err := watchdog.Check(nil); err == nil || !strings.Contains(err.Error(), "statefulpod/default/sp") {
+		t.Fatalf("Check() = %v; want stuck reconcile error", err)
+	}
+	done()
+	if err := watchdog.Check(nil); err != nil {
+		t.Fatalf("Check() = %v; want nil after reconcile finished", err)
+	}
+
+	// 未设置 watchdog 时不记录
+	var disabled *Watchdog
+	disabled.Track("statefulpod/default/sp")()
+}
@@ -0,0 +1,178 @@
+// 控制器配置，由 main 通过 --config 或环境变量 IAPETOS_CONFIG 指定 toml 文件加载，未指定时使用默认值；
+// nodeConfig、podConfig 可由 Watcher 在运行时热加载，managerConfig 修改后需重启生效
+package initconfig
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// 指定配置文件路径的环境变量
+const ConfigEnv = "IAPETOS_CONFIG"
+
+// 当前生效的配置，可在运行时由 Watcher 原子替换
+var current atomic.Value
+
+func init() {
+	current.Store(Default())
+}
+
+// 获取当前生效的配置，调用方每次使用时重新获取以读到最新的值
+func Get() Config {
+	return current.Load().(Config)
+}
+
+func Set(config Config) {
+	current.Store(config)
+}
+
+type Config struct {
+	Manager ManagerConfig `toml:"managerConfig"`
+	Node    NodeConfig    `toml:"nodeConfig"`
+	Pod     PodConfig     `toml:"podConfig"`
+}
+
+type ManagerConfig struct {
+	// metrics、健康检查监听地址，"0" 表示关闭
+	MetricsAddr     string `toml:"metricsAddr"`
+	HealthProbeAddr string `toml:"healthProbeAddr"`
+	// 缓存全量同步的周期，如 "10h"
+	SyncPeriod Duration `toml:"syncPeriod"`
+	// statefulPod 控制器的并发数
+	MaxConcurrentReconciles int `toml:"maxConcurrentReconciles"`
+	// reconcile 执行超过该时间视为卡死，healthz 检查失败后由 kubelet 重启
+	ReconcileTimeout Duration `toml:"reconcileTimeout"`
+	// 只监听这些 namespace，为空时监听所有 namespace
+	Namespaces []string `toml:"namespaces"`
+	// 只处理 labels 匹配该 selector 的 statefulPod，为空时处理所有 statefulPod
+	ShardSelector string `toml:"shardSelector"`
+	// debug、info、error
+	LogLevel                string `toml:"logLevel"`
+	LeaderElection          bool   `toml:"leaderElection"`
+	LeaderElectionID        string `toml:"leaderElectionID"`
+	LeaderElectionNamespace string `toml:"leaderElectionNamespace"`
+}
+
+type PodConfig struct {
+	// pod 创建超时时间（秒），超时的时间点由 reconcile 定时重新检查，不依赖 syncPeriod
+	Timeout int `toml:"timeout"`
+	// 成员持续就绪多久（秒）后视为可用，滚动重启时等待上一个成员可用
+	Ready int `toml:"ready"`
+}
+
+type NodeConfig struct {
+	// node 不健康持续多久（秒）后视为失联
+	Timeout int `toml:"timeout"`
+}
+
+// toml 中以字符串表示的时间，如 "30s"、"10h"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+var logLevels = []string{"debug", "info", "error"}
+
+func Default() Config {
+	return Config{
+		Manager: ManagerConfig{
+			MetricsAddr:             ":8080",
+			HealthProbeAddr:         ":8081",
+			SyncPeriod:              Duration{time.Hour * 10},
+			MaxConcurrentReconciles: 3,
+			ReconcileTimeout:        Duration{time.Minute * 5},
+			LogLevel:                "debug",
+			LeaderElectionID:        "3118b9d6.iapetos.foundary-cloud.io",
+		},
+		Node: NodeConfig{
+			Timeout: 30,
+		},
+		Pod: PodConfig{
+			Timeout: 120,
+			Ready:   120,
+		},
+	}
+}
+
+// 加载配置文件，文件中未设置的项使用默认值，path 为空时只使用默认值
+func Load(path string) (Config, error) {
+	config := Default()
+	if path == "" {
+		return config, nil
+	}
+	meta, err := toml.DecodeFile(path, &config)
+	if err != nil {
+		return config, fmt.Errorf("load config %v: %v", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) != 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return config, fmt.Errorf("load config %v: unknown keys %v", path, strings.Join(keys, ", "))
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid config %v: %v", path, err)
+	}
+	return config, nil
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Manager.SyncPeriod.Duration <= 0 {
+		errs = append(errs, errors.New("managerConfig.syncPeriod must be positive"))
+	}
+	if c.Manager.MaxConcurrentReconciles < 1 {
+		errs = append(errs, errors.New("managerConfig.maxConcurrentReconciles must be at least 1"))
+	}
+	if c.Manager.ReconcileTimeout.Duration <= 0 {
+		errs = append(errs, errors.New("managerConfig.reconcileTimeout must be positive"))
+	}
+	if _, err := labels.Parse(c.Manager.ShardSelector); err != nil {
+		errs = append(errs, fmt.Errorf("managerConfig.shardSelector: %v", err))
+	}
+	if !isLogLevel(c.Manager.LogLevel) {
+		errs = append(errs, fmt.Errorf("managerConfig.logLevel %q must be one of %v", c.Manager.LogLevel, strings.Join(logLevels, ", ")))
+	}
+	if c.Manager.LeaderElection && c.Manager.LeaderElectionID == "" {
+		errs = append(errs, errors.New("managerConfig.leaderElectionID is required when leaderElection is enabled"))
+	}
+	if c.Node.Timeout <= 0 {
+		errs = append(errs, errors.New("nodeConfig.timeout must be positive"))
+	}
+	if c.Pod.Timeout <= 0 {
+		errs = append(errs, errors.New("podConfig.timeout must be positive"))
+	}
+	if c.Pod.Ready < 0 {
+		errs = append(errs, errors.New("podConfig.ready must not be negative"))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func isLogLevel(level string) bool {
+	for _, l := range logLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
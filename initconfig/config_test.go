@@ -0,0 +1,84 @@
+package initconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "iapetos-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	config, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, Default()) {
+		t.Fatalf("Load(\"\") = %+v; want defaults", config)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("defaults are invalid: %v", err)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	// 未设置的项保留默认值
+	path := writeConfig(t, `
+[managerConfig]
+syncPeriod="30m"
+logLevel="info"
+
+[nodeConfig]
+timeout=60
+`)
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Manager.SyncPeriod.Duration != 30*time.Minute || config.Manager.LogLevel != "info" || config.Node.Timeout != 60 {
+		t.Fatalf("Load() = %+v; file values not applied", config)
+	}
+	if config.Manager.MetricsAddr != ":8080" || config.Pod.Timeout != 120 {
+		t.Fatalf("Load() = %+v; defaults not kept", config)
+	}
+}
+
+func TestLoadRejectsInvalid(t *testing.T) {
+	cases := map[string]struct {
+		content string
+		want    string
+	}{
+		"unknown key":    {"[podConfig]\ntimout=10\n", "unknown keys podConfig.timout"},
+		"bad duration":   {"[managerConfig]\nsyncPeriod=\"10\"\n", "missing unit"},
+		"bad log level":  {"[managerConfig]\nlogLevel=\"trace\"\n", "managerConfig.logLevel"},
+		"zero timeout":   {"[nodeConfig]\ntimeout=0\n", "nodeConfig.timeout"},
+		"no concurrency": {"[managerConfig]\nmaxConcurrentReconciles=0\n", "maxConcurrentReconciles"},
+		"bad selector":   {"[managerConfig]\nshardSelector=\"shard in (a\"\n", "managerConfig.shardSelector"},
+	}
+	for name, c := range cases {
+		if _, err := Load(writeConfig(t, c.content)); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: Load() error = %v; want containing %q", name, err, c.want)
+		}
+	}
+}
+
+func TestLoadShippedConfig(t *testing.T) {
+	if _, err := Load("../config/node_lost_connection/config.toml"); err != nil {
+		t.Fatal(err)
+	}
+}
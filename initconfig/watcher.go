@@ -0,0 +1,121 @@
+package initconfig
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	// 检查配置文件的周期；ConfigMap 挂载的文件由 kubelet 通过替换软链接更新，轮询比 inotify 更可靠
+	WatchInterval = time.Second * 10
+
+	EventReasonConfigReloaded = "ConfigReloaded"
+	EventReasonConfigInvalid  = "ConfigInvalid"
+)
+
+// 监听配置文件，在文件内容变化时重新加载并原子替换生效的 nodeConfig、podConfig
+type Watcher struct {
+	path     string
+	log      logr.Logger
+	recorder record.EventRecorder
+	// 事件关联的对象，一般为控制器所在的 pod，为空时只记录日志
+	ref     *corev1.ObjectReference
+	content []byte
+	// 配置生效后通知控制器重新处理所有 statefulPod
+	reloaded chan event.GenericEvent
+}
+
+func NewWatcher(path string, log logr.Logger, recorder record.EventRecorder, ref *corev1.ObjectReference) *Watcher {
+	// 缓冲为 1，控制器未启动（如未选上主）时合并多次通知，不阻塞加载
+	watcher := &Watcher{path: path, log: log, recorder: recorder, ref: ref, reloaded: make(chan event.GenericEvent, 1)}
+	// 启动时已加载过的内容不再重复加载
+	watcher.content, _ = ioutil.ReadFile(path)
+	return watcher
+}
+
+// 实现 manager.Runnable
+func (w *Watcher) Start(stop <-chan struct{}) error {
+	w.log.Info("watching config", "path", w.path, "interval", WatchInterval)
+	wait.Until(w.Reload, WatchInterval, stop)
+	return nil
+}
+
+// 每个副本都需要加载最新配置，不参与选主
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+// 文件内容变化时重新加载，加载失败时保留当前配置
+func (w *Watcher) Reload() {
+	content, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		w.log.Error(err, "read config error", "path", w.path)
+		return
+	}
+	if bytes.Equal(content, w.content) {
+		return
+	}
+	w.content = content
+	config, err := Load(w.path)
+	if err != nil {
+		w.log.Error(err, "reload config error, keep current config", "path", w.path)
+		w.event(corev1.EventTypeWarning, EventReasonConfigInvalid, "Keep current config: %v", err)
+		return
+	}
+	old := Get()
+	if !reflect.DeepEqual(config.Manager, old.Manager) {
+		w.log.Info("managerConfig changed, restart the manager to apply it", "path", w.path)
+	}
+	// managerConfig 只在启动时生效
+	config.Manager = old.Manager
+	changes := Diff(old, config)
+	if len(changes) == 0 {
+		return
+	}
+	Set(config)
+	w.log.Info("config reloaded", "path", w.path, "changes", changes)
+	w.event(corev1.EventTypeNormal, EventReasonConfigReloaded, "Config reloaded: %v", strings.Join(changes, ", "))
+	meta := &metav1.ObjectMeta{Name: "config"}
+	select {
+	case w.reloaded <- event.GenericEvent{Meta: meta}:
+	default:
+	}
+}
+
+// 配置重新加载生效后发出事件，用作控制器的 source.Channel
+func (w *Watcher) Reloaded() <-chan event.GenericEvent {
+	return w.reloaded
+}
+
+func (w *Watcher) event(eventType, reason, messageFmt string, args ...interface{}) {
+	if w.recorder == nil || w.ref == nil {
+		return
+	}
+	w.recorder.Eventf(w.ref, eventType, reason, messageFmt, args...)
+}
+
+// 列出可热加载的配置项的变化
+func Diff(old, new Config) []string {
+	var changes []string
+	if old.Node.Timeout != new.Node.Timeout {
+		changes = append(changes, fmt.Sprintf("nodeConfig.timeout %v -> %v", old.Node.Timeout, new.Node.Timeout))
+	}
+	if old.Pod.Timeout != new.Pod.Timeout {
+		changes = append(changes, fmt.Sprintf("podConfig.timeout %v -> %v", old.Pod.Timeout, new.Pod.Timeout))
+	}
+	if old.Pod.Ready != new.Pod.Ready {
+		changes = append(changes, fmt.Sprintf("podConfig.ready %v -> %v", old.Pod.Ready, new.Pod.Ready))
+	}
+	return changes
+}
@@ -0,0 +1,52 @@
+package initconfig
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestWatcherReload(t *testing.T) {
+	defer Set(Default())
+	path := writeConfig(t, "[nodeConfig]\ntimeout=30\n")
+	recorder := record.NewFakeRecorder(10)
+	watcher := NewWatcher(path, log.NullLogger{}, recorder, &corev1.ObjectReference{Kind: "Pod", Name: "manager"})
+
+	// 可热加载的配置项变化后立即生效，managerConfig 保持不变
+	if err := ioutil.WriteFile(path, []byte("[managerConfig]\nlogLevel=\"error\"\n[nodeConfig]\ntimeout=60\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	watcher.Reload()
+	if got := Get(); got.Node.Timeout != 60 || got.Manager.LogLevel != Default().Manager.LogLevel {
+		t.Fatalf("Get() = %+v; want node timeout 60 and unchanged managerConfig", got)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, EventReasonConfigReloaded) || !strings.Contains(event, "nodeConfig.timeout 30 -> 60") {
+		t.Fatalf("event = %q; want config reloaded", event)
+	}
+	select {
+	case <-watcher.Reloaded():
+	default:
+		t.Fatal("Reloaded() not notified after config reloaded")
+	}
+
+	// 非法配置不生效
+	if err := ioutil.WriteFile(path, []byte("[nodeConfig]\ntimeout=-1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	watcher.Reload()
+	if got := Get(); got.Node.Timeout != 60 {
+		t.Fatalf("Get().Node.Timeout = %v after invalid config; want 60", got.Node.Timeout)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, EventReasonConfigInvalid) {
+		t.Fatalf("event = %q; want config invalid", event)
+	}
+	select {
+	case <-watcher.Reloaded():
+		t.Fatal("Reloaded() notified after invalid config")
+	default:
+	}
+}
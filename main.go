@@ -19,18 +19,26 @@ package main
 import (
 	"flag"
 	"os"
-	"time"
+	"strings"
 
+	uberzap "go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
 	"github.com/q8s-io/iapetos/controllers"
-	_ "github.com/q8s-io/iapetos/initconfig"
+	"github.com/q8s-io/iapetos/health"
+	"github.com/q8s-io/iapetos/initconfig"
+	iapetosmetrics "github.com/q8s-io/iapetos/metrics"
+	"github.com/q8s-io/iapetos/shard"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -47,44 +55,179 @@ func init() {
 }
 
 func main() {
+	var configFile string
 	var metricsAddr string
 	var enableLeaderElection bool
+	var namespaces string
+	var shardSelector string
 
-	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&configFile, "config", os.Getenv(initconfig.ConfigEnv),
+		"The controller config file, defaults to $"+initconfig.ConfigEnv+". Built-in defaults are used when empty.")
+	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to, overrides the config file.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
-		"Enable leader election for controller manager. "+
+		"Enable leader election for controller manager, overrides the config file. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&namespaces, "namespaces", "",
+		"Comma separated namespaces to watch, overrides the config file. All namespaces are watched when empty.")
+	flag.StringVar(&shardSelector, "shard-selector", "",
+		"Only manage StatefulPods whose labels match this selector, overrides the config file. "+
+			"Instances sharing a cluster need disjoint selectors and distinct leader election IDs.")
 	flag.Parse()
 
-	syncTime := time.Duration(time.Second * 5)
+	config, err := initconfig.Load(configFile)
+	if err != nil {
+		ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+		setupLog.Error(err, "unable to load config")
+		os.Exit(1)
+	}
+	// 显式设置的参数优先于配置文件
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "metrics-addr":
+			config.Manager.MetricsAddr = metricsAddr
+		case "enable-leader-election":
+			config.Manager.LeaderElection = enableLeaderElection
+		case "namespaces":
+			config.Manager.Namespaces = splitNamespaces(namespaces)
+		case "shard-selector":
+			config.Manager.ShardSelector = shardSelector
+		}
+	})
+	if err := config.Validate(); err != nil {
+		ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+		setupLog.Error(err, "invalid config")
+		os.Exit(1)
+	}
+	initconfig.Set(config)
+	// 已在 Validate 中校验
+	selector, _ := labels.Parse(config.Manager.ShardSelector)
 
-	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	ctrl.SetLogger(zap.New(zap.UseDevMode(true), zap.Level(logLevel(config.Manager.LogLevel))))
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		SyncPeriod:         &syncTime, // 同步资源到本地 cache
-		MetricsBindAddress: metricsAddr,
-		Port:               9443,
-		LeaderElection:     enableLeaderElection,
-		LeaderElectionID:   "3118b9d6.iapetos.foundary-cloud.io",
+		Scheme:                  scheme,
+		MetricsBindAddress:      config.Manager.MetricsAddr,
+		HealthProbeBindAddress:  config.Manager.HealthProbeAddr,
+		SyncPeriod:              &config.Manager.SyncPeriod.Duration,
+		Port:                    9443,
+		LeaderElection:          config.Manager.LeaderElection,
+		LeaderElectionID:        config.Manager.LeaderElectionID,
+		LeaderElectionNamespace: config.Manager.LeaderElectionNamespace,
+		NewCache:                shard.NewCacheFunc(config.Manager.Namespaces),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	watchdog := health.NewWatchdog(config.Manager.ReconcileTimeout.Duration)
+	var configReloaded <-chan event.GenericEvent
+	if configFile != "" {
+		watcher := initconfig.NewWatcher(configFile, ctrl.Log.WithName("config"),
+			mgr.GetEventRecorderFor("statefulpod-controller"), managerPodRef())
+		if err = mgr.Add(watcher); err != nil {
+			setupLog.Error(err, "unable to watch config", "path", configFile)
+			os.Exit(1)
+		}
+		configReloaded = watcher.Reloaded()
+	}
 	if err = (&controllers.StatefulPodReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("StatefulPod"),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("StatefulPod"),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorderFor("statefulpod-controller"),
+		MaxConcurrentReconciles: config.Manager.MaxConcurrentReconciles,
+		Watchdog:                watchdog,
+		ShardSelector:           selector,
+		ConfigReloaded:          configReloaded,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "StatefulPod")
 		os.Exit(1)
 	}
+	if err = (&controllers.StatefulPodBackupReconciler{
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("controllers").WithName("StatefulPodBackup"),
+		Scheme:        mgr.GetScheme(),
+		Recorder:      mgr.GetEventRecorderFor("statefulpod-controller"),
+		Watchdog:      watchdog,
+		ShardSelector: selector,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "StatefulPodBackup")
+		os.Exit(1)
+	}
+	if err = (&controllers.NodeReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("Node"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Node")
+		os.Exit(1)
+	}
+	if err = iapetosmetrics.RegisterCollector(mgr.GetClient(), selector); err != nil {
+		setupLog.Error(err, "unable to register collector", "collector", "StatefulPod")
+		os.Exit(1)
+	}
+	if err = addHealthChecks(mgr, watchdog); err != nil {
+		setupLog.Error(err, "unable to set up health checks")
+		os.Exit(1)
+	}
 	// n+kubebuilder:scaffold:builder
 
-	setupLog.Info("starting manager")
+	setupLog.Info("starting manager", "namespaces", config.Manager.Namespaces, "shardSelector", selector.String())
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+func logLevel(level string) *uberzap.AtomicLevel {
+	atomicLevel := uberzap.NewAtomicLevel()
+	switch level {
+	case "debug":
+		atomicLevel.SetLevel(uberzap.DebugLevel)
+	case "error":
+		atomicLevel.SetLevel(uberzap.ErrorLevel)
+	default:
+		atomicLevel.SetLevel(uberzap.InfoLevel)
+	}
+	return &atomicLevel
+}
+
+// 就绪：缓存同步完成且为 leader；存活：没有卡死的 reconcile
+func addHealthChecks(mgr ctrl.Manager, watchdog *health.Watchdog) error {
+	cacheSync := health.NewCacheSyncCheck(mgr.GetCache())
+	if err := mgr.Add(cacheSync); err != nil {
+		return err
+	}
+	leader := health.NewLeaderCheck()
+	if err := mgr.Add(leader); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("cache-sync", cacheSync.Check); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("leader", leader.Check); err != nil {
+		return err
+	}
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		return err
+	}
+	return mgr.AddHealthzCheck("reconcile", watchdog.Check)
+}
+
+func splitNamespaces(namespaces string) []string {
+	var result []string
+	for _, namespace := range strings.Split(namespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			result = append(result, namespace)
+		}
+	}
+	return result
+}
+
+// 控制器所在的 pod，由 downward API 注入的 POD_NAME、POD_NAMESPACE 确定，用于记录配置变更事件
+func managerPodRef() *corev1.ObjectReference {
+	name, namespace := os.Getenv("POD_NAME"), os.Getenv("POD_NAMESPACE")
+	if name == "" || namespace == "" {
+		return nil
+	}
+	return &corev1.ObjectReference{Kind: "Pod", APIVersion: "v1", Name: name, Namespace: namespace}
+}
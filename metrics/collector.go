@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+// 抓取时读取 statefulPod 的超时时间
+const collectTimeout = time.Second * 10
+
+// 成员状态，与 pod_controller 中的状态一致
+var memberPhases = []corev1.PodPhase{"Preparing", corev1.PodRunning, "CreateTimeOut", "Deleting", "Fencing", "Migrating"}
+
+var pvcPhases = []corev1.PersistentVolumeClaimPhase{corev1.ClaimPending, corev1.ClaimBound, corev1.ClaimLost, "Deleting"}
+
+var (
+	memberLabels = []string{"namespace", "statefulpod", "ordinal"}
+
+	memberInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "member_info"),
+		"Information about a StatefulPod member: its pod, node, pvc and pv.",
+		append(memberLabels, "pod", "node", "pvc", "pv"), nil)
+	memberPhaseDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "member_phase"),
+		"The phase of a StatefulPod member, 1 for the current phase.",
+		append(memberLabels, "phase"), nil)
+	memberReadyDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "member_ready"),
+		"Whether the pod of a StatefulPod member is ready.",
+		memberLabels, nil)
+	memberRestartsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "member_container_restarts"),
+		"Total container restarts of the pod of a StatefulPod member.",
+		memberLabels, nil)
+	memberPVCPhaseDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "member_pvc_phase"),
+		"The phase of the pvc of a StatefulPod member, 1 for the current phase.",
+		append(memberLabels, "pvc", "phase"), nil)
+	memberPVCCapacityDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "member_pvc_capacity_bytes"),
+		"The capacity of the pvc of a StatefulPod member.",
+		append(memberLabels, "pvc", "storageclass"), nil)
+)
+
+// 按 StatefulPodStatus 为每个成员输出一条时间序列，不访问 api server，只读取缓存
+type StatefulPodCollector struct {
+	reader client.Reader
+	// 只导出当前分片的 statefulPod，避免多个控制器实例重复导出
+	selector labels.Selector
+}
+
+func NewStatefulPodCollector(reader client.Reader, selector labels.Selector) prometheus.Collector {
+	if selector == nil {
+		selector = labels.Everything()
+	}
+	return &StatefulPodCollector{reader, selector}
+}
+
+// 注册成员状态 collector
+func RegisterCollector(reader client.Reader, selector labels.Selector) error {
+	return metrics.Registry.Register(NewStatefulPodCollector(reader, selector))
+}
+
+func (c *StatefulPodCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- memberInfoDesc
+	ch <- memberPhaseDesc
+	ch <- memberReadyDesc
+	ch <- memberRestartsDesc
+	ch <- memberPVCPhaseDesc
+	ch <- memberPVCCapacityDesc
+}
+
+func (c *StatefulPodCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+	var statefulPodList iapetosapiv1.StatefulPodList
+	if err := c.reader.List(ctx, &statefulPodList, client.MatchingLabelsSelector{Selector: c.selector}); err != nil {
+		ctrl.Log.WithName("metrics").Error(err, "list statefulPod error")
+		return
+	}
+	for i := range statefulPodList.Items {
+		collectStatefulPod(ch, &statefulPodList.Items[i])
+	}
+}
+
+func collectStatefulPod(ch chan<- prometheus.Metric, statefulPod *iapetosapiv1.StatefulPod) {
+	for i, podStatus := range statefulPod.Status.PodStatusMes {
+		labels := []string{statefulPod.Namespace, statefulPod.Name, strconv.Itoa(i)}
+		var pvcStatus iapetosapiv1.PVCStatus
+		if i < len(statefulPod.Status.PVCStatusMes) {
+			pvcStatus = statefulPod.Status.PVCStatusMes[i]
+		}
+		ch <- prometheus.MustNewConstMetric(memberInfoDesc, prometheus.GaugeValue, 1,
+			append(labels, podStatus.PodName, podStatus.NodeName, pvcStatus.PVCName, pvcStatus.PVName)...)
+		for _, phase := range phaseValues(memberPhases, podStatus.Status) {
+			ch <- prometheus.MustNewConstMetric(memberPhaseDesc, prometheus.GaugeValue, boolValue(phase == podStatus.Status),
+				append(labels, string(phase))...)
+		}
+		ch <- prometheus.MustNewConstMetric(memberReadyDesc, prometheus.GaugeValue, boolValue(podStatus.Ready), labels...)
+		ch <- prometheus.MustNewConstMetric(memberRestartsDesc, prometheus.GaugeValue, float64(podStatus.RestartCount), labels...)
+		// 没有 pvc 模板的成员 pvcName 为 none
+		if statefulPod.Spec.PVCTemplate == nil || pvcStatus.PVCName == "" {
+			continue
+		}
+		for _, phase := range pvcPhaseValues(pvcStatus.Status) {
+			ch <- prometheus.MustNewConstMetric(memberPVCPhaseDesc, prometheus.GaugeValue, boolValue(phase == pvcStatus.Status),
+				append(labels, pvcStatus.PVCName, string(phase))...)
+		}
+		if capacity, err := resource.ParseQuantity(pvcStatus.Capacity); err == nil {
+			ch <- prometheus.MustNewConstMetric(memberPVCCapacityDesc, prometheus.GaugeValue, float64(capacity.Value()),
+				append(labels, pvcStatus.PVCName, pvcStatus.StorageClass)...)
+		}
+	}
+}
+
+// 已知的状态以及当前状态，当前状态未知时也输出
+func phaseValues(phases []corev1.PodPhase, current corev1.PodPhase) []corev1.PodPhase {
+	for _, phase := range phases {
+		if phase == current {
+			return phases
+		}
+	}
+	return append(phases[:len(phases):len(phases)], current)
+}
+
+func pvcPhaseValues(current corev1.PersistentVolumeClaimPhase) []corev1.PersistentVolumeClaimPhase {
+	for _, phase := range pvcPhases {
+		if phase == current {
+			return pvcPhases
+		}
+	}
+	return append(pvcPhases[:len(pvcPhases):len(pvcPhases)], current)
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
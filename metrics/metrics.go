@@ -0,0 +1,168 @@
+// statefulPod 操作与故障转移的 prometheus 指标，注册到 controller-runtime 的 metrics endpoint
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+const (
+	namespace = "iapetos"
+	subsystem = "statefulpod"
+)
+
+// pv 操作
+const (
+	PVRetain     = "retain"
+	PVRelease    = "release"
+	PVQuarantine = "quarantine"
+	PVRestore    = "restore"
+)
+
+var statefulPodLabels = []string{"namespace", "statefulpod"}
+
+var (
+	// 扩容、缩容的成员数
+	Expansions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "expansions_total",
+		Help:      "Number of members added to a StatefulPod.",
+	}, statefulPodLabels)
+	Shrinks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "shrinks_total",
+		Help:      "Number of members removed from a StatefulPod.",
+	}, statefulPodLabels)
+	// node 失联替换成员的次数，reason 为 NodeLost 或 ForcedFailover
+	Failovers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "failovers_total",
+		Help:      "Number of members replaced after their node was lost or a failover was forced.",
+	}, append(statefulPodLabels, "reason"))
+	CreateTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "create_timeouts_total",
+		Help:      "Number of member pods that did not become running in time.",
+	}, statefulPodLabels)
+	PVOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "pv_operations_total",
+		Help:      "Number of persistent volume retain, release, quarantine and restore operations.",
+	}, append(statefulPodLabels, "operation"))
+	ForcedDeletions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "forced_deletions_total",
+		Help:      "Number of member pods force deleted on a lost node.",
+	}, statefulPodLabels)
+
+	// 成员 pod 从创建到运行的时间
+	MemberStartupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "member_startup_duration_seconds",
+		Help:      "Time from creating a member pod until it is running and ready.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, statefulPodLabels)
+	// 从发现 node 失联到替换成员的时间，包括隔离 node、处理 pvc
+	FailoverDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "failover_duration_seconds",
+		Help:      "Time from detecting a lost node until the member is handed over for recreation.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, statefulPodLabels)
+
+	MembersDesired = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "members_desired",
+		Help:      "Desired number of members of a StatefulPod.",
+	}, statefulPodLabels)
+	MembersReady = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "members_ready",
+		Help:      "Number of running and ready members of a StatefulPod.",
+	}, statefulPodLabels)
+	MembersPreparing = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "members_preparing",
+		Help:      "Number of members whose pod was created and is not running yet.",
+	}, statefulPodLabels)
+	MembersFailing = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "members_failing",
+		Help:      "Number of members that timed out, lost their node or are being recreated.",
+	}, statefulPodLabels)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		Expansions,
+		Shrinks,
+		Failovers,
+		CreateTimeouts,
+		PVOperations,
+		ForcedDeletions,
+		MemberStartupDuration,
+		FailoverDuration,
+		MembersDesired,
+		MembersReady,
+		MembersPreparing,
+		MembersFailing,
+	)
+}
+
+// 根据 statefulPod status 更新成员数量指标
+func UpdateMembers(statefulPod *iapetosapiv1.StatefulPod) {
+	var ready, preparing, failing float64
+	for _, podStatus := range statefulPod.Status.PodStatusMes {
+		switch podStatus.Status {
+		case corev1.PodRunning:
+			if podStatus.Ready {
+				ready++
+			}
+		case "Preparing":
+			preparing++
+		case "CreateTimeOut", "Fencing", "Deleting":
+			failing++
+		}
+	}
+	desired := float64(0)
+	if statefulPod.Spec.Size != nil {
+		desired = float64(*statefulPod.Spec.Size)
+	}
+	MembersDesired.WithLabelValues(statefulPod.Namespace, statefulPod.Name).Set(desired)
+	MembersReady.WithLabelValues(statefulPod.Namespace, statefulPod.Name).Set(ready)
+	MembersPreparing.WithLabelValues(statefulPod.Namespace, statefulPod.Name).Set(preparing)
+	MembersFailing.WithLabelValues(statefulPod.Namespace, statefulPod.Name).Set(failing)
+}
+
+// statefulPod 删除后移除其指标
+func DeleteStatefulPod(statefulPod *iapetosapiv1.StatefulPod) {
+	for _, vec := range []*prometheus.GaugeVec{MembersDesired, MembersReady, MembersPreparing, MembersFailing} {
+		vec.DeleteLabelValues(statefulPod.Namespace, statefulPod.Name)
+	}
+}
+
+// 记录距离 since 的时间，since 为空时不记录
+func ObserveSince(histogram *prometheus.HistogramVec, statefulPod *iapetosapiv1.StatefulPod, since *metav1.Time) {
+	if since == nil {
+		return
+	}
+	histogram.WithLabelValues(statefulPod.Namespace, statefulPod.Name).Observe(time.Since(since.Time).Seconds())
+}
@@ -0,0 +1,155 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	"github.com/q8s-io/iapetos/services"
+)
+
+type BackupService struct {
+	*services.Resource
+}
+
+func NewBackupService(client client.Client) services.ServiceInf {
+	clientMsg := services.NewResource(client)
+	clientMsg.Log.WithName("statefulPodBackup")
+	return &BackupService{clientMsg}
+}
+
+func (b *BackupService) GetName(statefulPod *iapetosapiv1.StatefulPod, index int) *string {
+	name := fmt.Sprintf("%v-%v", statefulPod.Name, time.Now().Unix())
+	return &name
+}
+
+func (b *BackupService) CreateTemplate(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, name string, index int) interface{} {
+	backup := &iapetosapiv1.StatefulPodBackup{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       services.StatefulPodBackup,
+			APIVersion: iapetosapiv1.GroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: statefulPod.Namespace,
+			Annotations: map[string]string{
+				iapetosapiv1.GroupVersion.String(): "true",
+				services.ParentNmae:                statefulPod.Name,
+			},
+			// 备份不属于 statefulPod，删除 statefulPod 后备份及其快照保留，用于恢复
+			// 通过 parentName label 与 spec.statefulPodName 关联
+			Labels: map[string]string{
+				services.ParentNmae:      statefulPod.Name,
+				services.ScheduledBackup: "true",
+			},
+		},
+		Spec: iapetosapiv1.StatefulPodBackupSpec{
+			StatefulPodName: statefulPod.Name,
+		},
+	}
+	if policy := statefulPod.Spec.BackupPolicy; policy != nil {
+		backup.Spec.VolumeSnapshotClassName = policy.VolumeSnapshotClassName
+		backup.Spec.Mode = policy.Mode
+	}
+	return backup
+}
+
+func (b *BackupService) IsExists(ctx context.Context, nameSpaceName types.NamespacedName) (interface{}, bool) {
+	var backup iapetosapiv1.StatefulPodBackup
+	if err := b.Client.Get(ctx, nameSpaceName, &backup); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			b.Log.Error(err, "get statefulPodBackup error")
+		}
+		return nil, false
+	}
+	return &backup, true
+}
+
+func (b *BackupService) IsResourceVersionSame(ctx context.Context, obj interface{}) bool {
+	backup := obj.(*iapetosapiv1.StatefulPodBackup)
+	if newBackup, ok := b.IsExists(ctx, types.NamespacedName{
+		Namespace: backup.Namespace,
+		Name:      backup.Name,
+	}); !ok {
+		return false
+	} else {
+		// 判断 resource version 是否一致
+		return backup.ResourceVersion == newBackup.(*iapetosapiv1.StatefulPodBackup).ResourceVersion
+	}
+}
+
+func (b *BackupService) Create(ctx context.Context, obj interface{}) (interface{}, error) {
+	backup := obj.(*iapetosapiv1.StatefulPodBackup)
+	if err := b.Client.Create(ctx, backup); err != nil {
+		b.Log.Error(err, "create statefulPodBackup error")
+		return nil, err
+	}
+	return backup, nil
+}
+
+func (b *BackupService) Update(ctx context.Context, obj interface{}) (interface{}, error) {
+	backup := obj.(*iapetosapiv1.StatefulPodBackup)
+	if b.IsResourceVersionSame(ctx, backup) {
+		if err := b.Client.Update(ctx, backup); err != nil {
+			b.Log.Error(err, "update statefulPodBackup error")
+			return nil, err
+		}
+	} else {
+		err := services.NewConflictError("statefulPodBackup %v: %v", backup.Name, services.ResourceVersionUnSame)
+		b.Log.Error(err, "update statefulPodBackup error")
+		return nil, err
+	}
+	return backup, nil
+}
+
+func (b *BackupService) Delete(ctx context.Context, obj interface{}) error {
+	backup := obj.(*iapetosapiv1.StatefulPodBackup)
+	if err := b.Client.Delete(ctx, backup, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && client.IgnoreNotFound(err) != nil {
+		b.Log.Error(err, "delete statefulPodBackup error")
+		return err
+	}
+	return nil
+}
+
+func (b *BackupService) DeleteMandatory(ctx context.Context, obj interface{}, statefulPod *iapetosapiv1.StatefulPod) error {
+	return b.Delete(ctx, obj)
+}
+
+func (b *BackupService) Get(ctx context.Context, nameSpaceName types.NamespacedName) (interface{}, error) {
+	var backup iapetosapiv1.StatefulPodBackup
+	if err := b.Client.Get(ctx, nameSpaceName, &backup); err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+// 返回 statefulPod 最近一次完成的备份中 index 对应的可用快照，没有时返回空字符串
+func LatestSnapshot(ctx context.Context, c client.Reader, statefulPod *iapetosapiv1.StatefulPod, index int) string {
+	var backupList iapetosapiv1.StatefulPodBackupList
+	if err := c.List(ctx, &backupList, client.InNamespace(statefulPod.Namespace)); err != nil {
+		return ""
+	}
+	var latest *metav1.Time
+	name := ""
+	for _, backup := range backupList.Items {
+		if backup.Spec.StatefulPodName != statefulPod.Name || backup.Status.Phase != iapetosapiv1.BackupCompleted || !backup.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if latest != nil && !latest.Before(backup.Status.CompletionTime) {
+			continue
+		}
+		for _, member := range backup.Status.Snapshots {
+			if member.Index != nil && int(*member.Index) == index && member.ReadyToUse {
+				latest = backup.Status.CompletionTime
+				name = member.SnapshotName
+				break
+			}
+		}
+	}
+	return name
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// 错误类型，决定 reconcile 如何重试
+type ErrorType string
+
+const (
+	// 临时错误，如 apiserver 不可用，由 workqueue 指数退避重试
+	ErrorTransient ErrorType = "Transient"
+	// 对象已被修改，重新读取后立即重试
+	ErrorConflict ErrorType = "Conflict"
+	// spec 不合法，记录到 status condition，修改 spec 前不再重试
+	ErrorInvalidSpec ErrorType = "InvalidSpec"
+	// 依赖的外部对象不满足条件，如同名对象属于其他控制器，由 workqueue 指数退避重试
+	ErrorExternalDependency ErrorType = "ExternalDependency"
+)
+
+type Error struct {
+	Type ErrorType
+	// 用于 status condition 与事件的原因
+	Reason string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func NewTransientError(err error) error {
+	return &Error{Type: ErrorTransient, Reason: string(ErrorTransient), Err: err}
+}
+
+func NewConflictError(format string, args ...interface{}) error {
+	return &Error{Type: ErrorConflict, Reason: string(ErrorConflict), Err: fmt.Errorf(format, args...)}
+}
+
+func NewInvalidSpecError(reason, format string, args ...interface{}) error {
+	return &Error{Type: ErrorInvalidSpec, Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+func NewExternalDependencyError(reason, format string, args ...interface{}) error {
+	return &Error{Type: ErrorExternalDependency, Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+// 错误的类型，未分类的 apiserver 冲突视为 Conflict，其他错误视为 Transient
+func ClassifyError(err error) ErrorType {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Type
+	}
+	if apierrors.IsConflict(err) {
+		return ErrorConflict
+	}
+	return ErrorTransient
+}
+
+// 错误的原因，未分类的错误返回其类型
+func ErrorReason(err error) string {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Reason
+	}
+	return string(ClassifyError(err))
+}
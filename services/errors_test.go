@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := map[string]struct {
+		err  error
+		want ErrorType
+	}{
+		"untyped":      {errors.New("connection refused"), ErrorTransient},
+		"api conflict": {apierrors.NewConflict(schema.GroupResource{Resource: "pods"}, "sp-0", errors.New("modified")), ErrorConflict},
+		"conflict":     {NewConflictError("pod %v: %v", "sp-0", ResourceVersionUnSame), ErrorConflict},
+		"invalid spec": {NewInvalidSpecError("SizeRequired", "spec.size is required"), ErrorInvalidSpec},
+		"wrapped":      {fmt.Errorf("pod sp-0: %w", ErrNotOwned), ErrorExternalDependency},
+	}
+	for name, c := range cases {
+		if got := ClassifyError(c.err); got != c.want {
+			t.Errorf("%s: ClassifyError() = %v; want %v", name, got, c.want)
+		}
+	}
+	if reason := ErrorReason(fmt.Errorf("pvc sp-0: %w", ErrNotOwned)); reason != "NotOwned" {
+		t.Errorf("ErrorReason() = %v; want NotOwned", reason)
+	}
+}
+
+func TestSetCondition(t *testing.T) {
+	var status iapetosapiv1.StatefulPodStatus
+	condition := iapetosapiv1.StatefulPodCondition{
+		Type:    iapetosapiv1.StatefulPodInvalidSpec,
+		Status:  corev1.ConditionTrue,
+		Reason:  "SizeRequired",
+		Message: "spec.size is required",
+	}
+	if !SetCondition(&status, condition) || len(status.Conditions) != 1 {
+		t.Fatalf("SetCondition() conditions = %+v; want one added", status.Conditions)
+	}
+	// 相同的 condition 不重复更新
+	if SetCondition(&status, condition) {
+		t.Fatal("SetCondition() = true; want unchanged")
+	}
+	if !RemoveCondition(&status, iapetosapiv1.StatefulPodInvalidSpec) || len(status.Conditions) != 0 {
+		t.Fatalf("RemoveCondition() conditions = %+v; want none", status.Conditions)
+	}
+}
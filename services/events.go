@@ -0,0 +1,50 @@
+package services
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+// 事件原因，statefulPod 与受影响的子资源使用相同的原因
+const (
+	EventSuccessfulCreate   = "SuccessfulCreate"
+	EventFailedCreate       = "FailedCreate"
+	EventSuccessfulDelete   = "SuccessfulDelete"
+	EventFailedDelete       = "FailedDelete"
+	EventCreateTimeout      = "CreateTimeout"
+	EventNodeLost           = "NodeLost"
+	EventForceDelete        = "ForceDelete"
+	EventFenced             = "Fenced"
+	EventRetainPV           = "RetainPV"
+	EventReleasePV          = "ReleasePV"
+	EventQuarantinePV       = "QuarantinePV"
+	EventRestorePV          = "RestorePV"
+	EventAdopt              = "Adopt"
+	EventRelease            = "Release"
+	EventFinalizerAdded     = "FinalizerAdded"
+	EventFinalizerRemoved   = "FinalizerRemoved"
+	EventMigrate            = "Migrate"
+	EventMigrationCompleted = "MigrationCompleted"
+	EventMigrationFailed    = "MigrationFailed"
+	EventBackupScheduled    = "BackupScheduled"
+	EventBackupCompleted    = "BackupCompleted"
+	EventBackupFailed       = "BackupFailed"
+	EventBackupPruned       = "BackupPruned"
+	EventRestartCompleted   = "RestartCompleted"
+	EventInvalidSpec        = "InvalidSpec"
+)
+
+// 在 statefulPod 上记录事件，child 不为空时在子资源上记录相同的事件
+func RecordEvent(recorder record.EventRecorder, statefulPod *iapetosapiv1.StatefulPod, child runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if recorder == nil {
+		return
+	}
+	if statefulPod != nil {
+		recorder.Eventf(statefulPod, eventType, reason, messageFmt, args...)
+	}
+	if child != nil {
+		recorder.Eventf(child, eventType, reason, messageFmt, args...)
+	}
+}
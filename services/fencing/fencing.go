@@ -0,0 +1,178 @@
+package fencing
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	"github.com/q8s-io/iapetos/initconfig"
+)
+
+const (
+	// 管理员或隔离流程确认 node 已停止服务
+	TaintNodeOutOfService = "node.kubernetes.io/out-of-service"
+	// 控制器添加的污点使用该值，与管理员添加的污点区分，node 恢复后只移除控制器添加的污点
+	taintValue = "fenced-by-iapetos"
+)
+
+// 当前控制器实例添加的污点的值，分片部署时带上分片 selector 的 hash，
+// 多个分片隔离同一个 node 时只有添加污点的分片在 node 恢复后移除污点，避免各分片同时移除
+func controllerTaintValue() string {
+	// 已在加载配置时校验
+	selector, err := labels.Parse(initconfig.Get().Manager.ShardSelector)
+	if err != nil || selector.Empty() {
+		return taintValue
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(selector.String()))
+	return fmt.Sprintf("%v-%08x", taintValue, hash.Sum32())
+}
+
+type Fencer struct {
+	client.Client
+	Log logr.Logger
+}
+
+func NewFencer(client client.Client) *Fencer {
+	return &Fencer{client, ctrl.Log.WithName("fencing")}
+}
+
+// 按隔离策略隔离 node，node 确认停止运行时返回 true，node 已不存在时视为隔离完成
+// 隔离由 provider 确认，未配置 provider 时需要管理员为 node 添加 out-of-service 污点确认；
+// 控制器不会把自己添加的污点当作确认，确认后才按策略添加污点
+func (f *Fencer) FenceNode(ctx context.Context, policy *iapetosapiv1.FencingPolicy, nodeName string) (bool, error) {
+	if policy == nil || nodeName == "" {
+		return true, nil
+	}
+	var node corev1.Node
+	if err := f.Get(ctx, types.NamespacedName{Name: nodeName}, &node); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return true, nil
+		}
+		f.Log.Error(err, "get node error", "node", nodeName)
+		return false, err
+	}
+	// 已带有 out-of-service 污点：管理员已确认，或 provider 已确认后由控制器添加
+	if IsOutOfService(&node) {
+		return true, nil
+	}
+	if policy.Provider == "" {
+		return false, nil
+	}
+	provider, ok := GetProvider(policy.Provider)
+	if !ok {
+		err := fmt.Errorf("fencing provider %q is not registered", policy.Provider)
+		f.Log.Error(err, "fence node error", "node", nodeName)
+		return false, err
+	}
+	fenced, err := provider.Fence(ctx, &node)
+	if err != nil {
+		f.Log.Error(err, "fence node error", "node", nodeName, "provider", policy.Provider)
+		return false, err
+	}
+	if !fenced {
+		return false, nil
+	}
+	if policy.Taint {
+		if err := f.taintNode(ctx, &node); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// 移除控制器添加的 out-of-service 污点，调用方需确认 node 已恢复 Ready
+func (f *Fencer) Unfence(ctx context.Context, node *corev1.Node) error {
+	taints := make([]corev1.Taint, 0, len(node.Spec.Taints))
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == TaintNodeOutOfService && taint.Value == controllerTaintValue() {
+			continue
+		}
+		taints = append(taints, taint)
+	}
+	if len(taints) == len(node.Spec.Taints) {
+		return nil
+	}
+	node.Spec.Taints = taints
+	if err := f.Update(ctx, node); err != nil {
+		f.Log.Error(err, "remove node taint error", "node", node.Name)
+		return err
+	}
+	f.Log.Info("node is ready again, out-of-service taint removed", "node", node.Name)
+	return nil
+}
+
+// node 是否带有 out-of-service 污点
+func IsOutOfService(node *corev1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == TaintNodeOutOfService && taint.Effect == corev1.TaintEffectNoExecute {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否带有当前分片添加的 out-of-service 污点
+func IsFencedByController(node *corev1.Node) bool {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == TaintNodeOutOfService && taint.Value == controllerTaintValue() {
+			return true
+		}
+	}
+	return false
+}
+
+// 删除 pv 在 node 上的 VolumeAttachment，不存在 VolumeAttachment 时返回 true
+func (f *Fencer) DetachVolume(ctx context.Context, policy *iapetosapiv1.FencingPolicy, nodeName, pvName string) (bool, error) {
+	if policy == nil || !policy.DeleteVolumeAttachments || pvName == "" {
+		return true, nil
+	}
+	var attachments storagev1.VolumeAttachmentList
+	if err := f.List(ctx, &attachments); err != nil {
+		f.Log.Error(err, "list volumeAttachment error")
+		return false, err
+	}
+	detached := true
+	for i := range attachments.Items {
+		attachment := &attachments.Items[i]
+		if attachment.Spec.NodeName != nodeName || attachment.Spec.Source.PersistentVolumeName == nil ||
+			*attachment.Spec.Source.PersistentVolumeName != pvName {
+			continue
+		}
+		detached = false
+		if !attachment.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if err := f.Delete(ctx, attachment); err != nil && client.IgnoreNotFound(err) != nil {
+			f.Log.Error(err, "delete volumeAttachment error", "volumeAttachment", attachment.Name)
+			return false, err
+		}
+	}
+	return detached, nil
+}
+
+// 添加 out-of-service 污点，通知 kube-controller-manager 强制解除 node 上的卷挂载
+func (f *Fencer) taintNode(ctx context.Context, node *corev1.Node) error {
+	now := metav1.Now()
+	node.Spec.Taints = append(node.Spec.Taints, corev1.Taint{
+		Key:       TaintNodeOutOfService,
+		Value:     controllerTaintValue(),
+		Effect:    corev1.TaintEffectNoExecute,
+		TimeAdded: &now,
+	})
+	if err := f.Update(ctx, node); err != nil {
+		f.Log.Error(err, "taint node error", "node", node.Name)
+		return err
+	}
+	return nil
+}
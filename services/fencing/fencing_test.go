@@ -0,0 +1,170 @@
+package fencing
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	"github.com/q8s-io/iapetos/initconfig"
+)
+
+func TestFenceNodeTaint(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	fencer := NewFencer(fake.NewFakeClientWithScheme(scheme.Scheme, node))
+	policy := &iapetosapiv1.FencingPolicy{Taint: true}
+	ctx := context.Background()
+
+	// 没有 provider 时等待管理员确认，控制器不自行添加污点
+	if fenced, err := fencer.FenceNode(ctx, policy, "node-1"); err != nil || fenced {
+		t.Fatalf("FenceNode() = %v, %v; want false, nil", fenced, err)
+	}
+	var got corev1.Node
+	if err := fencer.Get(ctx, types.NamespacedName{Name: "node-1"}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Spec.Taints) != 0 {
+		t.Fatalf("taints = %v; want none before confirmation", got.Spec.Taints)
+	}
+
+	// 管理员添加的污点确认隔离，node 恢复后不会被移除
+	got.Spec.Taints = []corev1.Taint{{Key: TaintNodeOutOfService, Value: "nodeshutdown", Effect: corev1.TaintEffectNoExecute}}
+	if err := fencer.Update(ctx, &got); err != nil {
+		t.Fatal(err)
+	}
+	if fenced, err := fencer.FenceNode(ctx, policy, "node-1"); err != nil || !fenced {
+		t.Fatalf("FenceNode() = %v, %v; want true, nil", fenced, err)
+	}
+	if IsFencedByController(&got) {
+		t.Fatal("IsFencedByController() = true for an admin taint")
+	}
+	if err := fencer.Unfence(ctx, &got); err != nil || len(got.Spec.Taints) != 1 {
+		t.Fatalf("Unfence() = %v, taints %v; want the admin taint kept", err, got.Spec.Taints)
+	}
+}
+
+func TestFenceNodeProviderTaint(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	fencer := NewFencer(fake.NewFakeClientWithScheme(scheme.Scheme, node))
+	RegisterProvider("local-taint", NewLocalProvider(true))
+	ctx := context.Background()
+
+	// provider 确认后添加污点，node 恢复后移除
+	if fenced, err := fencer.FenceNode(ctx, &iapetosapiv1.FencingPolicy{Taint: true, Provider: "local-taint"}, "node-1"); err != nil || !fenced {
+		t.Fatalf("FenceNode() = %v, %v; want true, nil", fenced, err)
+	}
+	var got corev1.Node
+	if err := fencer.Get(ctx, types.NamespacedName{Name: "node-1"}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !IsFencedByController(&got) {
+		t.Fatalf("taints = %v; want %s added by the controller", got.Spec.Taints, TaintNodeOutOfService)
+	}
+	if err := fencer.Unfence(ctx, &got); err != nil || len(got.Spec.Taints) != 0 {
+		t.Fatalf("Unfence() = %v, taints %v; want none", err, got.Spec.Taints)
+	}
+}
+
+// 分片部署时只有添加污点的分片移除污点
+func TestUnfenceOtherShard(t *testing.T) {
+	defer initconfig.Set(initconfig.Get())
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	fencer := NewFencer(fake.NewFakeClientWithScheme(scheme.Scheme, node))
+	RegisterProvider("local-taint", NewLocalProvider(true))
+	ctx := context.Background()
+
+	config := initconfig.Default()
+	config.Manager.ShardSelector = "shard=a"
+	initconfig.Set(config)
+	if fenced, err := fencer.FenceNode(ctx, &iapetosapiv1.FencingPolicy{Taint: true, Provider: "local-taint"}, "node-1"); err != nil || !fenced {
+		t.Fatalf("FenceNode() = %v, %v; want true, nil", fenced, err)
+	}
+	var got corev1.Node
+	if err := fencer.Get(ctx, types.NamespacedName{Name: "node-1"}, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Manager.ShardSelector = "shard=b"
+	initconfig.Set(config)
+	if IsFencedByController(&got) {
+		t.Fatal("IsFencedByController() = true for a taint added by another shard")
+	}
+	if err := fencer.Unfence(ctx, &got); err != nil || len(got.Spec.Taints) != 1 {
+		t.Fatalf("Unfence() = %v, taints %v; want the taint of shard a kept", err, got.Spec.Taints)
+	}
+
+	config.Manager.ShardSelector = "shard=a"
+	initconfig.Set(config)
+	if err := fencer.Unfence(ctx, &got); err != nil || len(got.Spec.Taints) != 0 {
+		t.Fatalf("Unfence() = %v, taints %v; want none", err, got.Spec.Taints)
+	}
+}
+
+func TestFenceNodeProvider(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	fencer := NewFencer(fake.NewFakeClientWithScheme(scheme.Scheme, node))
+	ctx := context.Background()
+
+	if _, err := fencer.FenceNode(ctx, &iapetosapiv1.FencingPolicy{Provider: "unknown"}, "node-1"); err == nil {
+		t.Fatal("FenceNode() with unregistered provider returned no error")
+	}
+
+	unconfirmed := NewLocalProvider(false)
+	RegisterProvider("local-unconfirmed", unconfirmed)
+	if fenced, err := fencer.FenceNode(ctx, &iapetosapiv1.FencingPolicy{Provider: "local-unconfirmed"}, "node-1"); err != nil || fenced {
+		t.Fatalf("FenceNode() = %v, %v; want false, nil", fenced, err)
+	}
+	confirmed := NewLocalProvider(true)
+	RegisterProvider("local", confirmed)
+	if fenced, err := fencer.FenceNode(ctx, &iapetosapiv1.FencingPolicy{Provider: "local"}, "node-1"); err != nil || !fenced {
+		t.Fatalf("FenceNode() = %v, %v; want true, nil", fenced, err)
+	}
+	if confirmed.FencedTimes("node-1") != 1 {
+		t.Fatalf("FencedTimes() = %d; want 1", confirmed.FencedTimes("node-1"))
+	}
+
+	// node 已被删除时视为隔离完成
+	if fenced, err := fencer.FenceNode(ctx, &iapetosapiv1.FencingPolicy{Provider: "local-unconfirmed"}, "node-2"); err != nil || !fenced {
+		t.Fatalf("FenceNode() on missing node = %v, %v; want true, nil", fenced, err)
+	}
+}
+
+func TestDetachVolume(t *testing.T) {
+	pvName, otherPV := "pv-1", "pv-2"
+	attachment := func(name, nodeName string, pv *string) *storagev1.VolumeAttachment {
+		return &storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: storagev1.VolumeAttachmentSpec{
+				NodeName: nodeName,
+				Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: pv},
+			},
+		}
+	}
+	fencer := NewFencer(fake.NewFakeClientWithScheme(scheme.Scheme,
+		attachment("va-1", "node-1", &pvName),
+		attachment("va-2", "node-1", &otherPV),
+		attachment("va-3", "node-2", &pvName),
+	))
+	policy := &iapetosapiv1.FencingPolicy{DeleteVolumeAttachments: true}
+	ctx := context.Background()
+
+	if detached, err := fencer.DetachVolume(ctx, policy, "node-1", pvName); err != nil || detached {
+		t.Fatalf("first DetachVolume() = %v, %v; want false, nil", detached, err)
+	}
+	if detached, err := fencer.DetachVolume(ctx, policy, "node-1", pvName); err != nil || !detached {
+		t.Fatalf("second DetachVolume() = %v, %v; want true, nil", detached, err)
+	}
+	var attachments storagev1.VolumeAttachmentList
+	if err := fencer.List(ctx, &attachments); err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments.Items) != 2 {
+		t.Fatalf("remaining volumeAttachments = %d; want 2", len(attachments.Items))
+	}
+}
@@ -0,0 +1,34 @@
+package fencing
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// 本地隔离 provider，只记录被隔离的 node，用于测试和没有带外管理的环境
+type LocalProvider struct {
+	sync.Mutex
+	// 为 false 时隔离永远不会被确认
+	Confirm bool
+	fenced  map[string]int
+}
+
+func NewLocalProvider(confirm bool) *LocalProvider {
+	return &LocalProvider{Confirm: confirm, fenced: map[string]int{}}
+}
+
+func (l *LocalProvider) Fence(ctx context.Context, node *corev1.Node) (bool, error) {
+	l.Lock()
+	defer l.Unlock()
+	l.fenced[node.Name]++
+	return l.Confirm, nil
+}
+
+// 返回 node 被隔离的次数
+func (l *LocalProvider) FencedTimes(nodeName string) int {
+	l.Lock()
+	defer l.Unlock()
+	return l.fenced[nodeName]
+}
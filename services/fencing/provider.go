@@ -0,0 +1,33 @@
+package fencing
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// 隔离 provider，由外部系统实现，如 IPMI、云厂商 API
+type Provider interface {
+	// 隔离 node，返回 node 是否已确认停止运行
+	Fence(ctx context.Context, node *corev1.Node) (bool, error)
+}
+
+var (
+	providersLock sync.RWMutex
+	providers     = map[string]Provider{}
+)
+
+// 注册隔离 provider，statefulPod 通过 spec.fencing.provider 引用
+func RegisterProvider(name string, provider Provider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	providers[name] = provider
+}
+
+func GetProvider(name string) (Provider, bool) {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+	provider, ok := providers[name]
+	return provider, ok
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+// 设置成员 pod 的状态以及原因，状态变化时记录变化时间
+func SetPodPhase(podStatus *iapetosapiv1.PodStatus, phase corev1.PodPhase, reason, message string) {
+	if podStatus.Status != phase || podStatus.LastTransitionTime == nil {
+		now := metav1.Now()
+		podStatus.LastTransitionTime = &now
+	}
+	podStatus.Status = phase
+	podStatus.Reason = reason
+	podStatus.Message = message
+	if phase != corev1.PodRunning {
+		podStatus.Ready = false
+	}
+}
+
+// 设置成员 pvc 的状态以及原因，状态变化时记录变化时间
+func SetPVCPhase(pvcStatus *iapetosapiv1.PVCStatus, phase corev1.PersistentVolumeClaimPhase, reason, message string) {
+	if pvcStatus.Status != phase || pvcStatus.LastTransitionTime == nil {
+		now := metav1.Now()
+		pvcStatus.LastTransitionTime = &now
+	}
+	pvcStatus.Status = phase
+	pvcStatus.Reason = reason
+	pvcStatus.Message = message
+}
+
+// 记录 pod 的就绪状态与容器重启次数，返回是否改变
+func ObservePod(podStatus *iapetosapiv1.PodStatus, pod *corev1.Pod) bool {
+	ready := false
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			ready = condition.Status == corev1.ConditionTrue
+		}
+	}
+	var restartCount int32
+	for _, status := range pod.Status.ContainerStatuses {
+		restartCount += status.RestartCount
+	}
+	if podStatus.Ready == ready && podStatus.RestartCount == restartCount {
+		return false
+	}
+	podStatus.Ready = ready
+	podStatus.RestartCount = restartCount
+	return true
+}
+
+// pod 未运行的原因，无法调度或拉取镜像失败时返回对应的原因，否则返回容器等待的原因
+func PodWaitingReason(pod *corev1.Pod) (string, string) {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse && condition.Reason == corev1.PodReasonUnschedulable {
+			return iapetosapiv1.ReasonUnschedulable, condition.Message
+		}
+	}
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		waiting := status.State.Waiting
+		if waiting == nil || waiting.Reason == "" || waiting.Reason == "ContainerCreating" || waiting.Reason == "PodInitializing" {
+			continue
+		}
+		message := fmt.Sprintf("container %v: %v", status.Name, waiting.Message)
+		if waiting.Reason == "ErrImagePull" || waiting.Reason == iapetosapiv1.ReasonImagePullBackOff {
+			return iapetosapiv1.ReasonImagePullBackOff, message
+		}
+		return waiting.Reason, message
+	}
+	return "", ""
+}
+
+// 设置 statefulPod 的 condition，状态变化时记录变化时间，返回是否改变
+func SetCondition(status *iapetosapiv1.StatefulPodStatus, condition iapetosapiv1.StatefulPodCondition) bool {
+	for i := range status.Conditions {
+		current := &status.Conditions[i]
+		if current.Type != condition.Type {
+			continue
+		}
+		if current.Status == condition.Status && current.Reason == condition.Reason && current.Message == condition.Message {
+			return false
+		}
+		if current.Status == condition.Status {
+			condition.LastTransitionTime = current.LastTransitionTime
+		} else {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		*current = condition
+		return true
+	}
+	condition.LastTransitionTime = metav1.Now()
+	status.Conditions = append(status.Conditions, condition)
+	return true
+}
+
+// 移除 statefulPod 的 condition，返回是否改变
+func RemoveCondition(status *iapetosapiv1.StatefulPodStatus, conditionType iapetosapiv1.StatefulPodConditionType) bool {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			status.Conditions = append(status.Conditions[:i], status.Conditions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
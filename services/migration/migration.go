@@ -0,0 +1,96 @@
+// StatefulSet 迁移到 statefulPod，只依赖 api 包，供控制器和 kubectl 插件共同使用
+package migration
+
+import (
+	"errors"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+// 校验 StatefulSet 是否可以迁移到 statefulPod，pod、pvc 的名称必须一致才能复用
+func Validate(statefulPod *iapetosapiv1.StatefulPod, statefulSet *appsv1.StatefulSet) error {
+	if statefulSet.Name != statefulPod.Name {
+		return fmt.Errorf("statefulSet name %v must equal statefulPod name %v", statefulSet.Name, statefulPod.Name)
+	}
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	if replicas != *statefulPod.Spec.Size {
+		return fmt.Errorf("statefulPod size %v must equal statefulSet replicas %v", *statefulPod.Spec.Size, replicas)
+	}
+	switch len(statefulSet.Spec.VolumeClaimTemplates) {
+	case 0:
+		if statefulPod.Spec.PVCTemplate != nil {
+			return errors.New("statefulSet has no volumeClaimTemplates but statefulPod has pvcTemplate")
+		}
+	case 1:
+		if statefulPod.Spec.PVCTemplate == nil || len(statefulPod.Spec.PodTemplate.Volumes) == 0 ||
+			statefulPod.Spec.PodTemplate.Volumes[0].PersistentVolumeClaim == nil ||
+			statefulPod.Spec.PodTemplate.Volumes[0].PersistentVolumeClaim.ClaimName != statefulSet.Spec.VolumeClaimTemplates[0].Name {
+			return fmt.Errorf("the first volume of podTemplate must be a persistentVolumeClaim named %v", statefulSet.Spec.VolumeClaimTemplates[0].Name)
+		}
+	default:
+		return errors.New("only statefulSet with one volumeClaimTemplate can be migrated")
+	}
+	return nil
+}
+
+// 根据 StatefulSet 生成 statefulPod，pod 模板及其 label、annotation、selector、headless service 以及 pvc 模板与 StatefulSet 一致
+func FromStatefulSet(statefulSet *appsv1.StatefulSet) (*iapetosapiv1.StatefulPod, error) {
+	if len(statefulSet.Spec.VolumeClaimTemplates) > 1 {
+		return nil, errors.New("only statefulSet with one volumeClaimTemplate can be migrated")
+	}
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	podTemplate := statefulSet.Spec.Template.Spec.DeepCopy()
+	// pod 沿用 StatefulSet 的 headless service 做 dns 发现
+	podTemplate.Subdomain = statefulSet.Spec.ServiceName
+	statefulPod := &iapetosapiv1.StatefulPod{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StatefulPod",
+			APIVersion: iapetosapiv1.GroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      statefulSet.Name,
+			Namespace: statefulSet.Namespace,
+		},
+		Spec: iapetosapiv1.StatefulPodSpec{
+			Size:     &replicas,
+			Selector: statefulSet.Spec.Selector.DeepCopy(),
+			MigrateFrom: &iapetosapiv1.MigrationSource{
+				StatefulSetName: statefulSet.Name,
+			},
+		},
+	}
+	// 重建的 pod 保留 StatefulSet pod 模板的 label 和 annotation
+	if template := statefulSet.Spec.Template.DeepCopy(); len(template.Labels) != 0 || len(template.Annotations) != 0 {
+		statefulPod.Spec.PodMetadata = &iapetosapiv1.PodMetadata{
+			Labels:      template.Labels,
+			Annotations: template.Annotations,
+		}
+	}
+	if len(statefulSet.Spec.VolumeClaimTemplates) == 1 {
+		claimTemplate := statefulSet.Spec.VolumeClaimTemplates[0]
+		statefulPod.Spec.PVCTemplate = claimTemplate.Spec.DeepCopy()
+		// statefulPod 使用第一个 volume 的 claimName 作为 pvc 名称前缀，与 StatefulSet 的 pvc 名称一致
+		volumes := []corev1.Volume{{
+			Name: claimTemplate.Name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: claimTemplate.Name,
+				},
+			},
+		}}
+		podTemplate.Volumes = append(volumes, podTemplate.Volumes...)
+	}
+	statefulPod.Spec.PodTemplate = *podTemplate
+	return statefulPod, nil
+}
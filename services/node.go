@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	resourcecfg "github.com/q8s-io/iapetos/initconfig"
+	"github.com/q8s-io/iapetos/services/fencing"
+)
+
+const (
+	// kubelet 在该 namespace 下维护与 node 同名的 lease
+	NodeLeaseNamespace = "kube-node-lease"
+)
+
+func (r *Resource) IsNodeReady(ctx context.Context, nodeName types.NamespacedName) bool {
+	lostTime, err := r.NodeLostTime(ctx, nodeName)
+	if err != nil {
+		// 无法确认 node 状态时不做 failover
+		return true
+	}
+	if lostTime == nil {
+		return true
+	}
+	return time.Now().Before(*lostTime)
+}
+
+// 返回 node 被判定为失联的时间点，node 健康时返回 nil
+// node 不存在时返回当前时间，获取 node 出错时返回 error
+func (r *Resource) NodeLostTime(ctx context.Context, nodeName types.NamespacedName) (*time.Time, error) {
+	if nodeName.Name == "" {
+		return nil, nil
+	}
+	var node corev1.Node
+	if err := r.Get(ctx, nodeName, &node); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			r.Log.Error(err, "get node error")
+			return nil, err
+		}
+		now := time.Now()
+		return &now, nil
+	}
+	// lease 不存在（如关闭了 NodeLease 特性）时只依赖 node 自身的状态
+	var lease *coordinationv1.Lease
+	var nodeLease coordinationv1.Lease
+	if err := r.Get(ctx, types.NamespacedName{
+		Namespace: NodeLeaseNamespace,
+		Name:      node.Name,
+	}, &nodeLease); err == nil {
+		lease = &nodeLease
+	} else if client.IgnoreNotFound(err) != nil {
+		r.Log.Error(err, "get node lease error")
+		return nil, err
+	}
+	timeOut := time.Second * time.Duration(resourcecfg.Get().Node.Timeout)
+	return NodeLostTime(&node, lease, timeOut), nil
+}
+
+// 根据 node 的 Ready condition、污点以及 lease 续约时间计算 node 被判定为失联的时间点
+// Ready condition 不为 True 时 node 处于不健康状态，带有 not-ready/unreachable 污点时从更早的污点时间开始计时，不健康状态持续 timeOut 后视为失联；
+// 只有 Ready 为 Unknown（kubelet 未上报状态）时，lease 仍在续约说明 kubelet 依然存活，从最后一次续约开始计时；
+// Ready 为 False 时 kubelet 自身上报了不健康，续约 lease 不推迟失联时间。
+// lease 没有被 watch，续约停止不会触发事件，由调用方在返回的时间点重新检查
+func NodeLostTime(node *corev1.Node, lease *coordinationv1.Lease, timeOut time.Duration) *time.Time {
+	unhealthySince, ok := nodeUnhealthySince(node)
+	if !ok {
+		return nil
+	}
+	// 不健康且带有 out-of-service 污点的 node 已确认停止服务，直接视为失联；
+	// Ready 的 node 上的污点不作为失联依据，避免误加的污点使该 node 上所有成员被替换
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == fencing.TaintNodeOutOfService && taint.Effect == corev1.TaintEffectNoExecute {
+			lostTime := unhealthySince
+			if taint.TimeAdded != nil && taint.TimeAdded.Time.After(lostTime) {
+				lostTime = taint.TimeAdded.Time
+			}
+			return &lostTime
+		}
+	}
+	ready := GetNodeReadyCondition(node)
+	readyUnknown := ready == nil || ready.Status == corev1.ConditionUnknown
+	if readyUnknown && lease != nil && lease.Spec.RenewTime != nil && lease.Spec.RenewTime.Time.After(unhealthySince) {
+		unhealthySince = lease.Spec.RenewTime.Time
+	}
+	lostTime := unhealthySince.Add(timeOut)
+	return &lostTime
+}
+
+// 返回 node 开始不健康的时间
+// Ready 为 True 时 node 已恢复，残留的 not-ready/unreachable 污点等待 node lifecycle 控制器移除，不视为不健康
+func nodeUnhealthySince(node *corev1.Node) (time.Time, bool) {
+	ready := GetNodeReadyCondition(node)
+	if ready != nil && ready.Status == corev1.ConditionTrue {
+		return time.Time{}, false
+	}
+	// 尚未上报 Ready condition 的 node，从创建开始计时
+	since := node.CreationTimestamp.Time
+	if ready != nil {
+		since = ready.LastTransitionTime.Time
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key != corev1.TaintNodeUnreachable && taint.Key != corev1.TaintNodeNotReady {
+			continue
+		}
+		if taint.Effect != corev1.TaintEffectNoExecute || taint.TimeAdded == nil {
+			continue
+		}
+		// 取最早的不健康时间
+		if taint.TimeAdded.Time.Before(since) {
+			since = taint.TimeAdded.Time
+		}
+	}
+	return since, true
+}
+
+// 按类型查找 node 的 Ready condition
+func GetNodeReadyCondition(node *corev1.Node) *corev1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == corev1.NodeReady {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/q8s-io/iapetos/services/fencing"
+)
+
+var (
+	created = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	since   = created.Add(time.Hour)
+)
+
+func testNode(ready *corev1.ConditionStatus, taints ...corev1.Taint) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", CreationTimestamp: metav1.NewTime(created)}}
+	// Ready 之外的 condition 在前，确认按类型查找
+	node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionFalse}}
+	if ready != nil {
+		node.Status.Conditions = append(node.Status.Conditions, corev1.NodeCondition{
+			Type:               corev1.NodeReady,
+			Status:             *ready,
+			LastTransitionTime: metav1.NewTime(since),
+		})
+	}
+	node.Spec.Taints = taints
+	return node
+}
+
+func status(s corev1.ConditionStatus) *corev1.ConditionStatus {
+	return &s
+}
+
+func taint(key string, effect corev1.TaintEffect, added *time.Time) corev1.Taint {
+	t := corev1.Taint{Key: key, Effect: effect}
+	if added != nil {
+		t.TimeAdded = &metav1.Time{Time: *added}
+	}
+	return t
+}
+
+func TestNodeUnhealthySince(t *testing.T) {
+	earlier := since.Add(-time.Minute * 10)
+	cases := map[string]struct {
+		node  *corev1.Node
+		since time.Time
+		ok    bool
+	}{
+		"ready":                {testNode(status(corev1.ConditionTrue)), time.Time{}, false},
+		"not ready":            {testNode(status(corev1.ConditionFalse)), since, true},
+		"unknown":              {testNode(status(corev1.ConditionUnknown)), since, true},
+		"no ready condition":   {testNode(nil), created, true},
+		"earlier taint":        {testNode(status(corev1.ConditionFalse), taint(corev1.TaintNodeUnreachable, corev1.TaintEffectNoExecute, &earlier)), earlier, true},
+		"taint on ready node":  {testNode(status(corev1.ConditionTrue), taint(corev1.TaintNodeNotReady, corev1.TaintEffectNoExecute, &earlier)), time.Time{}, false},
+		"taint without time":   {testNode(status(corev1.ConditionTrue), taint(corev1.TaintNodeUnreachable, corev1.TaintEffectNoExecute, nil)), time.Time{}, false},
+		"untimed taint":        {testNode(status(corev1.ConditionFalse), taint(corev1.TaintNodeUnreachable, corev1.TaintEffectNoExecute, nil)), since, true},
+		"NoSchedule is benign": {testNode(status(corev1.ConditionTrue), taint(corev1.TaintNodeUnreachable, corev1.TaintEffectNoSchedule, &earlier)), time.Time{}, false},
+	}
+	for name, c := range cases {
+		got, ok := nodeUnhealthySince(c.node)
+		if ok != c.ok || !got.Equal(c.since) {
+			t.Errorf("%s: nodeUnhealthySince() = %v, %v; want %v, %v", name, got, ok, c.since, c.ok)
+		}
+	}
+}
+
+func TestNodeLostTime(t *testing.T) {
+	timeOut := time.Minute * 5
+	lease := func(renew time.Time) *coordinationv1.Lease {
+		return &coordinationv1.Lease{Spec: coordinationv1.LeaseSpec{RenewTime: &metav1.MicroTime{Time: renew}}}
+	}
+	renewed := since.Add(time.Minute * 3)
+	cases := map[string]struct {
+		node  *corev1.Node
+		lease *coordinationv1.Lease
+		want  *time.Time
+	}{
+		"ready":                      {testNode(status(corev1.ConditionTrue)), lease(renewed), nil},
+		"not ready":                  {testNode(status(corev1.ConditionFalse)), nil, timePtr(since.Add(timeOut))},
+		"unknown":                    {testNode(status(corev1.ConditionUnknown)), nil, timePtr(since.Add(timeOut))},
+		"unknown, lease renewed":     {testNode(status(corev1.ConditionUnknown)), lease(renewed), timePtr(renewed.Add(timeOut))},
+		"unknown, lease stale":       {testNode(status(corev1.ConditionUnknown)), lease(since.Add(-time.Minute)), timePtr(since.Add(timeOut))},
+		"no ready, lease renewed":    {testNode(nil), lease(renewed), timePtr(renewed.Add(timeOut))},
+		"not ready ignores lease":    {testNode(status(corev1.ConditionFalse)), lease(renewed), timePtr(since.Add(timeOut))},
+		"lease without renew time":   {testNode(status(corev1.ConditionUnknown)), &coordinationv1.Lease{}, timePtr(since.Add(timeOut))},
+		"out-of-service on ready":    {testNode(status(corev1.ConditionTrue), taint(fencing.TaintNodeOutOfService, corev1.TaintEffectNoExecute, &renewed)), nil, nil},
+		"out-of-service confirms":    {testNode(status(corev1.ConditionUnknown), taint(fencing.TaintNodeOutOfService, corev1.TaintEffectNoExecute, &renewed)), lease(renewed), &renewed},
+		"unreachable taint on ready": {testNode(status(corev1.ConditionTrue), taint(corev1.TaintNodeUnreachable, corev1.TaintEffectNoExecute, &since)), lease(renewed), nil},
+	}
+	for name, c := range cases {
+		got := NodeLostTime(c.node, c.lease, timeOut)
+		if (got == nil) != (c.want == nil) || (got != nil && !got.Equal(*c.want)) {
+			t.Errorf("%s: NodeLostTime() = %v; want %v", name, got, c.want)
+		}
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
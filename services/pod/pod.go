@@ -2,7 +2,6 @@ package pod
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
@@ -110,8 +109,9 @@ func (p *PodService) Update(ctx context.Context, obj interface{}) (interface{},
 			return nil, err
 		}
 	} else {
-		p.Log.Error(errors.New(""), services.ResourceVersionUnSame)
-		return nil, errors.New("")
+		err := services.NewConflictError("pod %v: %v", pod.Name, services.ResourceVersionUnSame)
+		p.Log.Error(err, "update pod error")
+		return nil, err
 	}
 	return pod, nil
 }
@@ -140,9 +140,15 @@ func (p *PodService) DeleteMandatory(ctx context.Context, obj interface{}, state
 
 // 添加annotation 用于扩展
 func (p *PodService) addAnnotations(statefulPod *iapetosapiv1.StatefulPod, pod *corev1.Pod, index int) {
-	pod.Annotations = statefulPod.Annotations
-	if pod.Annotations == nil {
-		pod.Annotations = map[string]string{}
+	// 复制 spec.podMetadata 以及 statefulPod 的 annotation，包括滚动重启使用的 restartedAt
+	pod.Annotations = make(map[string]string, len(statefulPod.Annotations)+3)
+	if statefulPod.Spec.PodMetadata != nil {
+		for k, v := range statefulPod.Spec.PodMetadata.Annotations {
+			pod.Annotations[k] = v
+		}
+	}
+	for k, v := range statefulPod.Annotations {
+		pod.Annotations[k] = v
 	}
 	pod.Annotations[iapetosapiv1.GroupVersion.String()] = "true"
 	pod.Annotations[services.ParentNmae] = statefulPod.Name
@@ -159,7 +165,7 @@ func (p *PodService) webhook(ctx context.Context, pod *corev1.Pod, statefulPod *
 	if _, ok := pod.Annotations["nodeUnhealthy"]; !ok {
 		pod.Annotations["nodeUnhealthy"] = "true"
 		_, _ = p.Update(ctx, pod)
-		return errors.New("")
+		return services.NewTransientError(fmt.Errorf("pod %v: nodeUnhealthy annotation added", pod.Name))
 	}
 	return nil
 }
@@ -173,23 +179,10 @@ func (p *PodService) setPvc(statefulPod *iapetosapiv1.StatefulPod, pod *corev1.P
 
 // 添加label 到 pod ，并添加subdomain
 func (p *PodService) setLabels(statefulPod *iapetosapiv1.StatefulPod, pod *corev1.Pod) {
-	lables := map[string]string{}
 	if statefulPod.Spec.ServiceTemplate != nil {
 		pod.Spec.Subdomain = p.SetServiceName(statefulPod)
-		for k, v := range statefulPod.Spec.ServiceTemplate.Selector {
-			if _, ok := lables[k]; !ok {
-				lables[k] = v
-			}
-		}
-	}
-	if statefulPod.Spec.Selector != nil {
-		for k, v := range statefulPod.Spec.Selector.MatchLabels {
-			if _, ok := lables[k]; !ok {
-				lables[k] = v
-			}
-		}
 	}
-	pod.Labels = lables
+	pod.Labels = services.MemberLabels(statefulPod)
 }
 
 func (p *PodService) Get(ctx context.Context, nameSpaceName types.NamespacedName) (interface{}, error) {
@@ -2,7 +2,6 @@ package pv
 
 import (
 	"context"
-	"errors"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -76,8 +75,9 @@ func (pv *PVService) Update(ctx context.Context, obj interface{}) (interface{},
 			return nil, err
 		}
 	} else {
-		pv.Log.Error(errors.New(""), services.ResourceVersionUnSame)
-		return nil, errors.New("")
+		err := services.NewConflictError("pv %v: %v", pvObj.Name, services.ResourceVersionUnSame)
+		pv.Log.Error(err, "update pv error")
+		return nil, err
 	}
 	return pvObj, nil
 }
@@ -0,0 +1,87 @@
+package pvc
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	"github.com/q8s-io/iapetos/services/snapshot"
+)
+
+// 播种快照的名称，每个 index 只有一个
+func SeedSnapshotName(statefulPod *iapetosapiv1.StatefulPod, index int) string {
+	return fmt.Sprintf("%v-seed-%v", statefulPod.Name, index)
+}
+
+// 首次创建成员 pvc 时使用的数据源，spec.restoreFrom 优先于 spec.seedPolicy
+// 返回数据源、播种使用的 peer pvc 名称，以及数据源是否可用，不可用时不能创建成员；获取备份失败时返回错误
+func InitialDataSource(ctx context.Context, c client.Client, statefulPod *iapetosapiv1.StatefulPod, index int) (*corev1.TypedLocalObjectReference, string, bool, error) {
+	dataSource, ok, err := snapshot.RestoreDataSource(ctx, c, statefulPod, index)
+	if err != nil || !ok {
+		return nil, "", false, err
+	}
+	if dataSource != nil {
+		return dataSource, "", true, nil
+	}
+	peerIndex, ok := seedPeerIndex(statefulPod, index)
+	if !ok {
+		return nil, "", true, nil
+	}
+	// 等待 peer 的 pvc 可用
+	if peerIndex >= len(statefulPod.Status.PVCStatusMes) || statefulPod.Status.PVCStatusMes[peerIndex].Status != corev1.ClaimBound {
+		return nil, "", false, nil
+	}
+	peerPVCName := statefulPod.Status.PVCStatusMes[peerIndex].PVCName
+	if statefulPod.Spec.SeedPolicy.Mode == iapetosapiv1.SeedModeClone {
+		return &corev1.TypedLocalObjectReference{
+			Kind: "PersistentVolumeClaim",
+			Name: peerPVCName,
+		}, peerPVCName, true, nil
+	}
+	snapshotHandler := snapshot.NewSnapshotService(c)
+	obj, exists := snapshotHandler.IsExists(ctx, client.ObjectKey{
+		Namespace: statefulPod.Namespace,
+		Name:      SeedSnapshotName(statefulPod, index),
+	})
+	if !exists {
+		return nil, "", false, nil
+	}
+	seedSnapshot := obj.(*unstructured.Unstructured)
+	// 快照失败时不再播种，新成员通过网络全量同步
+	if snapshot.GetErrorMessage(seedSnapshot) != "" {
+		return nil, "", true, nil
+	}
+	if !snapshot.IsReadyToUse(seedSnapshot) {
+		return nil, "", false, nil
+	}
+	return snapshot.DataSource(seedSnapshot.GetName()), peerPVCName, true, nil
+}
+
+// 作为数据来源的成员 index，只有 index 更小的成员可以作为 peer
+func seedPeerIndex(statefulPod *iapetosapiv1.StatefulPod, index int) (int, bool) {
+	policy := statefulPod.Spec.SeedPolicy
+	if policy == nil || statefulPod.Spec.PVCTemplate == nil {
+		return 0, false
+	}
+	peerIndex := 0
+	if policy.PeerIndex != nil {
+		peerIndex = int(*policy.PeerIndex)
+	}
+	return peerIndex, peerIndex < index
+}
+
+// 是否需要为 index 创建播种快照，需要时返回 peer 的 index
+func SeedSnapshotPeer(ctx context.Context, c client.Client, statefulPod *iapetosapiv1.StatefulPod, index int) (int, bool) {
+	if statefulPod.Spec.SeedPolicy == nil || statefulPod.Spec.SeedPolicy.Mode != iapetosapiv1.SeedModeSnapshot {
+		return 0, false
+	}
+	// 从备份恢复的成员不需要播种
+	if dataSource, ok, err := snapshot.RestoreDataSource(ctx, c, statefulPod, index); err != nil || !ok || dataSource != nil {
+		return 0, false
+	}
+	return seedPeerIndex(statefulPod, index)
+}
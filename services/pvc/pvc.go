@@ -2,7 +2,6 @@ package pvc
 
 import (
 	"context"
-	"errors"
 	"strconv"
 
 	corev1 "k8s.io/api/core/v1"
@@ -51,6 +50,15 @@ func (pvc *PVCService) CreateTemplate(ctx context.Context, statefulPod *iapetosa
 			statefulPod.Spec.PVCTemplate.VolumeName = statefulPod.Spec.PVNames[index]
 		}
 	}
+	pvcSpec := statefulPod.Spec.PVCTemplate.DeepCopy()
+	// 使用为该 index 记录的数据源创建 pvc，首次创建成员时从备份恢复或从 peer 播种
+	if index < len(statefulPod.Status.PVCStatusMes) {
+		if dataSource := statefulPod.Status.PVCStatusMes[index].DataSource; dataSource != nil {
+			pvcSpec.DataSource = dataSource.DeepCopy()
+		}
+	} else if dataSource, _, ok, _ := InitialDataSource(ctx, pvc.Client, statefulPod, index); ok && dataSource != nil {
+		pvcSpec.DataSource = dataSource
+	}
 	return &corev1.PersistentVolumeClaim{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "PersistentVolumeClaim",
@@ -75,7 +83,7 @@ func (pvc *PVCService) CreateTemplate(ctx context.Context, statefulPod *iapetosa
 				}),
 			},
 		},
-		Spec: *statefulPod.Spec.PVCTemplate.DeepCopy(),
+		Spec: *pvcSpec,
 	}
 }
 
@@ -125,8 +133,9 @@ func (pvc *PVCService) Update(ctx context.Context, obj interface{}) (interface{}
 			return nil, err
 		}
 	} else {
-		pvc.Log.Error(errors.New(""), services.ResourceVersionUnSame)
-		return nil, errors.New("")
+		err := services.NewConflictError("pvc %v: %v", pvcObj.Name, services.ResourceVersionUnSame)
+		pvc.Log.Error(err, "update pvc error")
+		return nil, err
 	}
 	return pvcObj, nil
 }
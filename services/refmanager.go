@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+// 以 controller 为 statefulPod 的 uid 建立 pod、pvc 的索引，用于查找 statefulPod 的所有 pod、pvc
+const ControllerUIDField = ".metadata.controllerUID"
+
+func IndexControllerUID(obj runtime.Object) []string {
+	meta, ok := obj.(metav1.Object)
+	if !ok {
+		return nil
+	}
+	controllerRef := metav1.GetControllerOf(meta)
+	if controllerRef == nil || controllerRef.APIVersion != iapetosapiv1.GroupVersion.String() || controllerRef.Kind != StatefulPod {
+		return nil
+	}
+	return []string{string(controllerRef.UID)}
+}
+
+// 以成员 pod、pvc 名称去掉序号后的前缀建立 statefulPod 的索引，用于查找可能认领孤儿 pod、pvc 的 statefulPod
+const MemberPrefixField = ".spec.memberPrefix"
+
+func IndexMemberPrefix(obj runtime.Object) []string {
+	statefulPod, ok := obj.(*iapetosapiv1.StatefulPod)
+	if !ok {
+		return nil
+	}
+	prefixes := []string{statefulPod.Name}
+	if statefulPod.Spec.PVCTemplate != nil {
+		prefix, _ := MemberPrefix((&Resource{}).SetPVCName(statefulPod, 0))
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// 去掉成员名称末尾的序号，名称不以序号结尾时不可能是成员
+func MemberPrefix(name string) (string, bool) {
+	i := strings.LastIndex(name, "-")
+	if i <= 0 {
+		return "", false
+	}
+	if _, err := strconv.Atoi(name[i+1:]); err != nil {
+		return "", false
+	}
+	return name[:i], true
+}
+
+// 与成员同名的对象属于其他控制器，或不匹配 selector
+var ErrNotOwned = &Error{
+	Type:   ErrorExternalDependency,
+	Reason: "NotOwned",
+	Err:    errors.New("object exists and is not owned by the statefulPod"),
+}
+
+// 认领、释放 statefulPod 的 pod 和 pvc，行为与 kube-controller-manager 的 ControllerRefManager 一致
+// 名称与成员一致、label 匹配 selector 且没有 controller 的对象被认领；
+// 属于 statefulPod 但不再匹配的对象被释放
+type RefManager struct {
+	*Resource
+	statefulPod *iapetosapiv1.StatefulPod
+	selector    labels.Selector
+	recorder    record.EventRecorder
+}
+
+func NewRefManager(client client.Client, recorder record.EventRecorder, statefulPod *iapetosapiv1.StatefulPod) (*RefManager, error) {
+	selector := labels.Everything()
+	if statefulPod.Spec.Selector != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(statefulPod.Spec.Selector); err != nil {
+			return nil, err
+		}
+	}
+	return &RefManager{NewResource(client), statefulPod, selector, recorder}, nil
+}
+
+// 认领或释放 pod，返回 pod 是否属于 statefulPod
+func (m *RefManager) ClaimPod(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	index, match := m.MatchPod(pod)
+	return m.claim(ctx, pod, pod, match, index)
+}
+
+// 认领或释放 pvc，返回 pvc 是否属于 statefulPod
+func (m *RefManager) ClaimPVC(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	index, match := m.MatchPVC(pvc)
+	return m.claim(ctx, pvc, pvc, match, index)
+}
+
+// 成员 pod 携带的 label：service selector、spec.selector.matchLabels 以及 spec.podMetadata.labels
+// matchExpressions 不会添加到 pod 上，需要由这些 label 满足
+func MemberLabels(statefulPod *iapetosapiv1.StatefulPod) map[string]string {
+	memberLabels := map[string]string{}
+	if statefulPod.Spec.ServiceTemplate != nil {
+		for k, v := range statefulPod.Spec.ServiceTemplate.Selector {
+			memberLabels[k] = v
+		}
+	}
+	if statefulPod.Spec.Selector != nil {
+		for k, v := range statefulPod.Spec.Selector.MatchLabels {
+			if _, ok := memberLabels[k]; !ok {
+				memberLabels[k] = v
+			}
+		}
+	}
+	if statefulPod.Spec.PodMetadata != nil {
+		for k, v := range statefulPod.Spec.PodMetadata.Labels {
+			if _, ok := memberLabels[k]; !ok {
+				memberLabels[k] = v
+			}
+		}
+	}
+	return memberLabels
+}
+
+// pod 的名称与成员一致且 label 匹配 selector，返回成员 index
+func (m *RefManager) MatchPod(pod *corev1.Pod) (int, bool) {
+	index, ok := m.memberIndex(pod.Name, fmt.Sprintf("%v-", m.statefulPod.Name))
+	return index, ok && m.selector.Matches(labels.Set(pod.Labels))
+}
+
+// pvc 不带 selector 中的 label，只按名称匹配
+func (m *RefManager) MatchPVC(pvc *corev1.PersistentVolumeClaim) (int, bool) {
+	if m.statefulPod.Spec.PVCTemplate == nil {
+		return 0, false
+	}
+	return m.memberIndex(pvc.Name, strings.TrimSuffix(m.SetPVCName(m.statefulPod, 0), "0"))
+}
+
+// 从名称中解析成员 index，只有 index 小于 spec.size 且没有在迁移中的对象才是成员
+func (m *RefManager) memberIndex(name, prefix string) (int, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return 0, false
+	}
+	suffix := strings.TrimPrefix(name, prefix)
+	index, err := strconv.Atoi(suffix)
+	if err != nil || strconv.Itoa(index) != suffix || index < 0 {
+		return 0, false
+	}
+	if index >= int(*m.statefulPod.Spec.Size) {
+		return 0, false
+	}
+	// 迁移中的成员仍属于 StatefulSet
+	if index < len(m.statefulPod.Status.PodStatusMes) && m.statefulPod.Status.PodStatusMes[index].Status == Migrating {
+		return 0, false
+	}
+	return index, true
+}
+
+func (m *RefManager) claim(ctx context.Context, obj runtime.Object, meta metav1.Object, match bool, index int) (bool, error) {
+	// 正在删除的对象既不认领也不释放
+	if !meta.GetDeletionTimestamp().IsZero() {
+		controllerRef := metav1.GetControllerOf(meta)
+		return controllerRef != nil && controllerRef.UID == m.statefulPod.UID, nil
+	}
+	if controllerRef := metav1.GetControllerOf(meta); controllerRef != nil {
+		if controllerRef.UID != m.statefulPod.UID {
+			// 属于其他控制器
+			return false, nil
+		}
+		if match {
+			return true, nil
+		}
+		// statefulPod 删除时由垃圾回收处理，不释放
+		if !m.statefulPod.DeletionTimestamp.IsZero() {
+			return false, nil
+		}
+		if err := m.release(ctx, obj, meta); err != nil {
+			if client.IgnoreNotFound(err) == nil {
+				return false, nil
+			}
+			return false, err
+		}
+		return false, nil
+	}
+	// 孤儿对象
+	if !match || !m.statefulPod.DeletionTimestamp.IsZero() {
+		return false, nil
+	}
+	if err := m.adopt(ctx, obj, meta, index); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// 认领前确认 statefulPod 没有被删除或重建，避免使用过期的缓存认领对象
+func (m *RefManager) canAdopt(ctx context.Context) error {
+	var fresh iapetosapiv1.StatefulPod
+	if err := m.Get(ctx, types.NamespacedName{
+		Namespace: m.statefulPod.Namespace,
+		Name:      m.statefulPod.Name,
+	}, &fresh); err != nil {
+		return err
+	}
+	if fresh.UID != m.statefulPod.UID {
+		return fmt.Errorf("original statefulPod %v/%v is gone: got uid %v, wanted %v", m.statefulPod.Namespace, m.statefulPod.Name, fresh.UID, m.statefulPod.UID)
+	}
+	if !fresh.DeletionTimestamp.IsZero() {
+		return fmt.Errorf("statefulPod %v/%v has just been deleted at %v", m.statefulPod.Namespace, m.statefulPod.Name, fresh.DeletionTimestamp)
+	}
+	return nil
+}
+
+// 添加 controller ownerReference 以及控制器使用的 annotation、label
+func (m *RefManager) adopt(ctx context.Context, obj runtime.Object, meta metav1.Object, index int) error {
+	if err := m.canAdopt(ctx); err != nil {
+		m.Log.Error(err, "can't adopt", "name", meta.GetName())
+		return err
+	}
+	meta.SetOwnerReferences(append(meta.GetOwnerReferences(), *metav1.NewControllerRef(m.statefulPod, schema.GroupVersionKind{
+		Group:   iapetosapiv1.GroupVersion.Group,
+		Version: iapetosapiv1.GroupVersion.Version,
+		Kind:    StatefulPod,
+	})))
+	annotations := meta.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[iapetosapiv1.GroupVersion.String()] = "true"
+	annotations[ParentNmae] = m.statefulPod.Name
+	annotations[Index] = strconv.Itoa(index)
+	meta.SetAnnotations(annotations)
+	if _, ok := obj.(*corev1.PersistentVolumeClaim); ok {
+		objLabels := meta.GetLabels()
+		if objLabels == nil {
+			objLabels = map[string]string{}
+		}
+		objLabels[ParentNmae] = m.statefulPod.Name
+		meta.SetLabels(objLabels)
+	}
+	m.Log.Info("adopt", "statefulPod", m.statefulPod.Name, "name", meta.GetName())
+	if err := m.Update(ctx, obj); err != nil {
+		return err
+	}
+	RecordEvent(m.recorder, m.statefulPod, obj, corev1.EventTypeNormal, EventAdopt, "adopt %v as member %v", meta.GetName(), index)
+	return nil
+}
+
+// 移除 ownerReference 以及控制器使用的 annotation、label
+func (m *RefManager) release(ctx context.Context, obj runtime.Object, meta metav1.Object) error {
+	ownerReferences := make([]metav1.OwnerReference, 0, len(meta.GetOwnerReferences()))
+	for _, ref := range meta.GetOwnerReferences() {
+		if ref.UID != m.statefulPod.UID {
+			ownerReferences = append(ownerReferences, ref)
+		}
+	}
+	meta.SetOwnerReferences(ownerReferences)
+	annotations := meta.GetAnnotations()
+	delete(annotations, iapetosapiv1.GroupVersion.String())
+	delete(annotations, ParentNmae)
+	delete(annotations, Index)
+	meta.SetAnnotations(annotations)
+	objLabels := meta.GetLabels()
+	delete(objLabels, ParentNmae)
+	meta.SetLabels(objLabels)
+	m.Log.Info("release", "statefulPod", m.statefulPod.Name, "name", meta.GetName())
+	if err := m.Update(ctx, obj); err != nil {
+		return err
+	}
+	RecordEvent(m.recorder, m.statefulPod, obj, corev1.EventTypeNormal, EventRelease, "release %v which no longer matches", meta.GetName())
+	return nil
+}
@@ -3,7 +3,6 @@ package services
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
@@ -12,7 +11,6 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
-	resourcecfg "github.com/q8s-io/iapetos/initconfig"
 )
 
 type ServiceInf interface {
@@ -31,7 +29,15 @@ const (
 	ResourceVersionUnSame = "ResourceVersionUnSame"
 	ParentNmae            = "parentName"
 	StatefulPod           = "StatefulPod"
+	StatefulPodBackup     = "StatefulPodBackup"
 	Index                 = "index"
+	Backup                = "backup"
+	// 由 backupPolicy 调度创建的备份，只有这些备份按保留数量清理
+	ScheduledBackup = "scheduledBackup"
+	// 替换成员时为 pvc 创建的快照，替代 pvc 恢复完成后删除
+	FailoverSnapshot = "failoverSnapshot"
+	// 成员仍由迁移来源的 StatefulSet 管理
+	Migrating = "Migrating"
 )
 
 type Resource struct {
@@ -71,34 +77,14 @@ func (r *Resource) IsPvCanUse(ctx context.Context, pvNameSpaceName *types.Namesp
 	return &nodeName, true
 }
 
-func (r *Resource) IsNodeReady(ctx context.Context, nodeName types.NamespacedName) bool {
-	if nodeName.Name == "" {
-		return true
-	}
-	var node corev1.Node
-	// 判断 node 是否存在
-	if err := r.Get(ctx, nodeName, &node); err != nil {
-		if client.IgnoreNotFound(err) != nil {
-			r.Log.Error(err, "get node error")
-		}
-		return false
-	}
-	// 存在，判断是否超时，即判断 node.spec.conditions 最后一个元素的状态是否为 true，若不为 true，判断失联时间是否超时
-	timeOut := time.Second * time.Duration(resourcecfg.StatefulPodResourceCfg.Node.Timeout)
-	if node.Status.Conditions[len(node.Status.Conditions)-1].Status != corev1.ConditionTrue {
-		lostConnectTime := node.Status.Conditions[len(node.Status.Conditions)-1].LastTransitionTime
-		if time.Now().Sub(lostConnectTime.Time) >= timeOut {
-			return false
-		}
-	}
-	return true
-}
-
+// pvc 名称为 <claimName>-<statefulPod>-<index>，claimName 为空时使用 data；只读取 spec，不修改
 func (r *Resource) SetPVCName(statefulPod *iapetosapiv1.StatefulPod, index int) string {
-	if statefulPod.Spec.PodTemplate.Volumes[0].PersistentVolumeClaim.ClaimName == "" {
-		statefulPod.Spec.PodTemplate.Volumes[0].PersistentVolumeClaim.ClaimName = "data"
+	claimName := "data"
+	if volumes := statefulPod.Spec.PodTemplate.Volumes; len(volumes) > 0 && volumes[0].PersistentVolumeClaim != nil &&
+		volumes[0].PersistentVolumeClaim.ClaimName != "" {
+		claimName = volumes[0].PersistentVolumeClaim.ClaimName
 	}
-	return fmt.Sprintf("%v-%v-%v", statefulPod.Spec.PodTemplate.Volumes[0].PersistentVolumeClaim.ClaimName, statefulPod.Name, index)
+	return fmt.Sprintf("%v-%v-%v", claimName, statefulPod.Name, index)
 }
 
 func (r *Resource) SetServiceName(statefulPod *iapetosapiv1.StatefulPod) string {
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+func TestSetPVCName(t *testing.T) {
+	volume := func(claimName string) corev1.Volume {
+		return corev1.Volume{Name: "data", VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+		}}
+	}
+	cases := map[string]struct {
+		volumes []corev1.Volume
+		want    string
+	}{
+		"claim name":     {[]corev1.Volume{volume("disk")}, "disk-sp-1"},
+		"empty claim":    {[]corev1.Volume{volume("")}, "data-sp-1"},
+		"no volume":      {nil, "data-sp-1"},
+		"not pvc volume": {[]corev1.Volume{{Name: "data"}}, "data-sp-1"},
+	}
+	for name, c := range cases {
+		sp := &iapetosapiv1.StatefulPod{ObjectMeta: metav1.ObjectMeta{Name: "sp"}}
+		sp.Spec.PodTemplate.Volumes = c.volumes
+		if got := (&Resource{}).SetPVCName(sp, 1); got != c.want {
+			t.Errorf("%s: SetPVCName() = %v; want %v", name, got, c.want)
+		}
+		// 只读取 spec
+		if len(c.volumes) > 0 && c.volumes[0].PersistentVolumeClaim != nil && c.volumes[0].PersistentVolumeClaim.ClaimName == "" &&
+			sp.Spec.PodTemplate.Volumes[0].PersistentVolumeClaim.ClaimName != "" {
+			t.Errorf("%s: SetPVCName() modified spec", name)
+		}
+	}
+}
+
+func TestMemberPrefix(t *testing.T) {
+	sp := &iapetosapiv1.StatefulPod{ObjectMeta: metav1.ObjectMeta{Name: "sp"}}
+	sp.Spec.PVCTemplate = &corev1.PersistentVolumeClaimSpec{}
+	prefixes := IndexMemberPrefix(sp)
+	for _, name := range []string{"sp-0", "sp-12", "data-sp-3"} {
+		prefix, ok := MemberPrefix(name)
+		if !ok || (prefix != prefixes[0] && prefix != prefixes[1]) {
+			t.Errorf("MemberPrefix(%v) = %v, %v; want one of %v", name, prefix, ok, prefixes)
+		}
+	}
+	for _, name := range []string{"sp", "sp-a", "-1"} {
+		if prefix, ok := MemberPrefix(name); ok {
+			t.Errorf("MemberPrefix(%v) = %v, true; want false", name, prefix)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package service
 
 import (
 	"context"
-	"errors"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -104,8 +103,9 @@ func (svc *Service) Update(ctx context.Context, obj interface{}) (interface{}, e
 			return nil, err
 		}
 	} else {
-		svc.Log.Error(errors.New(""), services.ResourceVersionUnSame)
-		return nil, errors.New("")
+		err := services.NewConflictError("service %v: %v", service.Name, services.ResourceVersionUnSame)
+		svc.Log.Error(err, "update service error")
+		return nil, err
 	}
 	return service, nil
 }
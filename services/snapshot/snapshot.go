@@ -0,0 +1,256 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	"github.com/q8s-io/iapetos/services"
+)
+
+const (
+	APIGroup = "snapshot.storage.k8s.io"
+	Kind     = "VolumeSnapshot"
+)
+
+// 不引入 external-snapshotter 的依赖，以 unstructured 的方式操作 VolumeSnapshot
+var GroupVersionKind = schema.GroupVersionKind{
+	Group:   APIGroup,
+	Version: "v1beta1",
+	Kind:    Kind,
+}
+
+type SnapshotService struct {
+	*services.Resource
+}
+
+func NewSnapshotService(client client.Client) services.ServiceInf {
+	clientMsg := services.NewResource(client)
+	clientMsg.Log.WithName("volumeSnapshot")
+	return &SnapshotService{clientMsg}
+}
+
+// 成员快照名称的前缀，完整名称见 FailoverName
+func (s *SnapshotService) GetName(statefulPod *iapetosapiv1.StatefulPod, index int) *string {
+	name := s.SetPVCName(statefulPod, index)
+	return &name
+}
+
+// 替换成员时为 pvc 创建的快照的名称，由 pvc 名称与 UID 确定，
+// 每次替换的 pvc 都是新建的，同一次替换重复创建时得到相同的名称
+func FailoverName(pvc *corev1.PersistentVolumeClaim) string {
+	return fmt.Sprintf("%v-%v", pvc.Name, pvc.UID)
+}
+
+// 为 index 对应的 pvc 创建快照
+func (s *SnapshotService) CreateTemplate(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod, name string, index int) interface{} {
+	return newSnapshot(statefulPod, name, s.SetPVCName(statefulPod, index), index, statefulPod.Spec.VolumeSnapshotClassName, statefulPodRef(statefulPod))
+}
+
+// 替换成员时为 pvc 创建快照，替代 pvc 恢复完成后删除
+func FailoverTemplate(statefulPod *iapetosapiv1.StatefulPod, pvc *corev1.PersistentVolumeClaim, index int) *unstructured.Unstructured {
+	snapshot := newSnapshot(statefulPod, FailoverName(pvc), pvc.Name, index, statefulPod.Spec.VolumeSnapshotClassName, statefulPodRef(statefulPod))
+	labels := snapshot.GetLabels()
+	labels[services.FailoverSnapshot] = "true"
+	snapshot.SetLabels(labels)
+	return snapshot
+}
+
+// 是否为替换成员时创建的快照
+func IsFailoverSnapshot(snapshot *unstructured.Unstructured) bool {
+	_, ok := snapshot.GetLabels()[services.FailoverSnapshot]
+	return ok
+}
+
+func statefulPodRef(statefulPod *iapetosapiv1.StatefulPod) metav1.OwnerReference {
+	return *metav1.NewControllerRef(statefulPod, schema.GroupVersionKind{
+		Group:   iapetosapiv1.GroupVersion.Group,
+		Version: iapetosapiv1.GroupVersion.Version,
+		Kind:    services.StatefulPod,
+	})
+}
+
+// 为备份创建成员快照，快照属于 backup，随 backup 一起删除
+func BackupTemplate(statefulPod *iapetosapiv1.StatefulPod, backup *iapetosapiv1.StatefulPodBackup, pvcName string, index int) *unstructured.Unstructured {
+	className := backup.Spec.VolumeSnapshotClassName
+	if className == nil {
+		className = statefulPod.Spec.VolumeSnapshotClassName
+	}
+	snapshot := newSnapshot(statefulPod, fmt.Sprintf("%v-%v", backup.Name, index), pvcName, index, className,
+		*metav1.NewControllerRef(backup, schema.GroupVersionKind{
+			Group:   iapetosapiv1.GroupVersion.Group,
+			Version: iapetosapiv1.GroupVersion.Version,
+			Kind:    services.StatefulPodBackup,
+		}))
+	labels := snapshot.GetLabels()
+	labels[services.Backup] = backup.Name
+	snapshot.SetLabels(labels)
+	return snapshot
+}
+
+func newSnapshot(statefulPod *iapetosapiv1.StatefulPod, name, pvcName string, index int, className *string, owner metav1.OwnerReference) *unstructured.Unstructured {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(GroupVersionKind)
+	snapshot.SetName(name)
+	snapshot.SetNamespace(statefulPod.Namespace)
+	snapshot.SetAnnotations(map[string]string{
+		iapetosapiv1.GroupVersion.String(): "true",
+		services.ParentNmae:                statefulPod.Name,
+		services.Index:                     strconv.Itoa(index),
+	})
+	snapshot.SetLabels(map[string]string{
+		services.ParentNmae: statefulPod.Name,
+	})
+	snapshot.SetOwnerReferences([]metav1.OwnerReference{owner})
+	_ = unstructured.SetNestedField(snapshot.Object, pvcName, "spec", "source", "persistentVolumeClaimName")
+	if className != nil {
+		_ = unstructured.SetNestedField(snapshot.Object, *className, "spec", "volumeSnapshotClassName")
+	}
+	return snapshot
+}
+
+func (s *SnapshotService) IsExists(ctx context.Context, nameSpaceName types.NamespacedName) (interface{}, bool) {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(GroupVersionKind)
+	if err := s.Client.Get(ctx, nameSpaceName, snapshot); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			s.Log.Error(err, "get volumeSnapshot error")
+		}
+		return nil, false
+	}
+	return snapshot, true
+}
+
+func (s *SnapshotService) IsResourceVersionSame(ctx context.Context, obj interface{}) bool {
+	snapshot := obj.(*unstructured.Unstructured)
+	if newSnapshot, ok := s.IsExists(ctx, types.NamespacedName{
+		Namespace: snapshot.GetNamespace(),
+		Name:      snapshot.GetName(),
+	}); !ok {
+		return false
+	} else {
+		return snapshot.GetResourceVersion() == newSnapshot.(*unstructured.Unstructured).GetResourceVersion()
+	}
+}
+
+func (s *SnapshotService) Create(ctx context.Context, obj interface{}) (interface{}, error) {
+	snapshot := obj.(*unstructured.Unstructured)
+	if err := s.Client.Create(ctx, snapshot); err != nil {
+		s.Log.Error(err, "create volumeSnapshot error")
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (s *SnapshotService) Update(ctx context.Context, obj interface{}) (interface{}, error) {
+	snapshot := obj.(*unstructured.Unstructured)
+	if s.IsResourceVersionSame(ctx, snapshot) {
+		if err := s.Client.Update(ctx, snapshot); err != nil {
+			s.Log.Error(err, "update volumeSnapshot error")
+			return nil, err
+		}
+	} else {
+		err := services.NewConflictError("volumeSnapshot %v: %v", snapshot.GetName(), services.ResourceVersionUnSame)
+		s.Log.Error(err, "update volumeSnapshot error")
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (s *SnapshotService) Delete(ctx context.Context, obj interface{}) error {
+	snapshot := obj.(*unstructured.Unstructured)
+	if err := s.Client.Delete(ctx, snapshot); err != nil && client.IgnoreNotFound(err) != nil {
+		s.Log.Error(err, "delete volumeSnapshot error")
+		return err
+	}
+	return nil
+}
+
+func (s *SnapshotService) DeleteMandatory(ctx context.Context, obj interface{}, statefulPod *iapetosapiv1.StatefulPod) error {
+	return s.Delete(ctx, obj)
+}
+
+func (s *SnapshotService) Get(ctx context.Context, nameSpaceName types.NamespacedName) (interface{}, error) {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(GroupVersionKind)
+	if err := s.Client.Get(ctx, nameSpaceName, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// 快照是否可以用于恢复 pvc
+func IsReadyToUse(snapshot *unstructured.Unstructured) bool {
+	ready, found, err := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+	return err == nil && found && ready
+}
+
+// 快照对应的源 pvc 名称
+func GetSourcePVCName(snapshot *unstructured.Unstructured) string {
+	name, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+	return name
+}
+
+// 快照出错时返回错误信息
+func GetErrorMessage(snapshot *unstructured.Unstructured) string {
+	message, _, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message")
+	return message
+}
+
+// 作为 pvc dataSource 引用快照
+func DataSource(name string) *corev1.TypedLocalObjectReference {
+	apiGroup := APIGroup
+	return &corev1.TypedLocalObjectReference{
+		APIGroup: &apiGroup,
+		Kind:     Kind,
+		Name:     name,
+	}
+}
+
+// dataSource 是否引用快照
+func IsSnapshotDataSource(dataSource *corev1.TypedLocalObjectReference) bool {
+	return dataSource != nil && dataSource.Kind == Kind && dataSource.APIGroup != nil && *dataSource.APIGroup == APIGroup
+}
+
+// 返回 index 对应成员的恢复数据源，没有数据源时返回 nil
+// 备份尚未完成时返回 false，此时不能创建成员 pvc；备份不存在时返回 ExternalDependency 错误
+func RestoreDataSource(ctx context.Context, c client.Reader, statefulPod *iapetosapiv1.StatefulPod, index int) (*corev1.TypedLocalObjectReference, bool, error) {
+	restore := statefulPod.Spec.RestoreFrom
+	if restore == nil {
+		return nil, true, nil
+	}
+	if index < len(restore.DataSources) && restore.DataSources[index].Name != "" {
+		return restore.DataSources[index].DeepCopy(), true, nil
+	}
+	if restore.BackupName == "" {
+		return nil, true, nil
+	}
+	var backup iapetosapiv1.StatefulPodBackup
+	if err := c.Get(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      restore.BackupName,
+	}, &backup); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, services.NewExternalDependencyError("BackupNotFound", "spec.restoreFrom.backupName: backup %v not found", restore.BackupName)
+		}
+		return nil, false, err
+	}
+	if backup.Status.Phase != iapetosapiv1.BackupCompleted {
+		return nil, false, nil
+	}
+	for _, member := range backup.Status.Snapshots {
+		if member.Index != nil && int(*member.Index) == index && member.ReadyToUse {
+			return DataSource(member.SnapshotName), true, nil
+		}
+	}
+	return nil, true, nil
+}
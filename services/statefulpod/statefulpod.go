@@ -2,14 +2,27 @@ package statefulpod
 
 import (
 	"context"
+	"reflect"
+	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
 	"github.com/q8s-io/iapetos/services"
 )
 
+// 更新冲突时的重试间隔与次数，共约 1.5 秒
+var UpdateBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: time.Millisecond * 100,
+	Factor:   2.0,
+	Jitter:   0.1,
+}
+
 type StatefulPodService struct {
 	*services.Resource
 }
@@ -72,16 +85,59 @@ func (sfp *StatefulPodService) Create(ctx context.Context, obj interface{}) (int
 	return statefulPod, nil
 }
 
+// 控制器只写入 status 与 finalizer；status 是在读取到的 statefulPod 上逐步修改的，读取之后被修改过时不覆盖。
+// cache 中的对象与本次修改所基于的版本不一致时返回冲突，有限次数退避重试：
+// 同一次 reconcile 中前一次写入尚未同步到 cache 时，等待 cache 同步后写入；
+// statefulPod 确实被修改过时重试后仍冲突，由 workqueue 立即重新处理，在最新的对象上重新计算
 func (sfp *StatefulPodService) Update(ctx context.Context, obj interface{}) (interface{}, error) {
 	statefulPod := obj.(*iapetosapiv1.StatefulPod)
-Update:
-	if err := sfp.Client.Update(ctx, statefulPod); err != nil && client.IgnoreNotFound(err) != nil {
-		sfp.getNewResourceVersion(ctx, statefulPod)
-		goto Update
+	err := retry.OnError(UpdateBackoff, isConflict, func() error {
+		return sfp.patch(ctx, statefulPod)
+	})
+	if err != nil && client.IgnoreNotFound(err) != nil {
+		sfp.Log.Error(err, "update statefulPod error", "statefulPod", statefulPod.Name)
+		return nil, err
 	}
 	return statefulPod, nil
 }
 
+// apiserver 返回的冲突以及 patch 前检查到的版本不一致
+func isConflict(err error) bool {
+	return services.ClassifyError(err) == services.ErrorConflict
+}
+
+// 以 merge patch 只写入变化的 status 与 finalizer，patch 中带有 resourceVersion，statefulPod 被修改时返回冲突
+func (sfp *StatefulPodService) patch(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) error {
+	var latest iapetosapiv1.StatefulPod
+	if err := sfp.Client.Get(ctx, types.NamespacedName{
+		Namespace: statefulPod.Namespace,
+		Name:      statefulPod.Name,
+	}, &latest); err != nil {
+		return err
+	}
+	if latest.UID != statefulPod.UID {
+		return apierrors.NewNotFound(iapetosapiv1.GroupVersion.WithResource("statefulpods").GroupResource(), statefulPod.Name)
+	}
+	desired := latest.DeepCopy()
+	desired.Status = *statefulPod.Status.DeepCopy()
+	desired.Finalizers = append([]string(nil), statefulPod.Finalizers...)
+	if reflect.DeepEqual(desired.Status, latest.Status) && reflect.DeepEqual(desired.Finalizers, latest.Finalizers) {
+		latest.DeepCopyInto(statefulPod)
+		return nil
+	}
+	// cache 尚未同步或修改基于过期的对象，此时计算的 patch 不可靠，覆盖会丢失其他修改
+	if latest.ResourceVersion != statefulPod.ResourceVersion {
+		return services.NewConflictError("statefulPod %v: %v", statefulPod.Name, services.ResourceVersionUnSame)
+	}
+	base := latest.DeepCopy()
+	base.ResourceVersion = ""
+	if err := sfp.Client.Patch(ctx, desired, client.MergeFrom(base)); err != nil {
+		return err
+	}
+	desired.DeepCopyInto(statefulPod)
+	return nil
+}
+
 func (sfp *StatefulPodService) Delete(ctx context.Context, obj interface{}) error {
 	statefulPod := obj.(*iapetosapiv1.StatefulPod)
 	if err := sfp.Client.Delete(ctx, statefulPod); err != nil && client.IgnoreNotFound(err) != nil {
@@ -91,18 +147,6 @@ func (sfp *StatefulPodService) Delete(ctx context.Context, obj interface{}) erro
 	return nil
 }
 
-func (sfp *StatefulPodService) getNewResourceVersion(ctx context.Context, statefulPod *iapetosapiv1.StatefulPod) {
-	var newStatefulPod iapetosapiv1.StatefulPod
-	if err := sfp.Client.Get(ctx, types.NamespacedName{
-		Namespace: statefulPod.Namespace,
-		Name:      statefulPod.Name,
-	}, &newStatefulPod); err != nil {
-		return
-	}
-	statefulPod.ResourceVersion = newStatefulPod.ResourceVersion
-	return
-}
-
 func (sfp *StatefulPodService) Get(ctx context.Context, nameSpaceName types.NamespacedName) (interface{}, error) {
 	return nil, nil
 }
@@ -0,0 +1,147 @@
+package statefulpod
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+	"github.com/q8s-io/iapetos/services"
+)
+
+func TestUpdateRejectsStaleStatus(t *testing.T) {
+	defer fastBackoff()()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = iapetosapiv1.AddToScheme(scheme)
+	size := int32(1)
+	c := fake.NewFakeClientWithScheme(scheme, &iapetosapiv1.StatefulPod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sp"},
+		Spec:       iapetosapiv1.StatefulPodSpec{Size: &size},
+	})
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "sp"}
+
+	// 控制器读取后，用户修改了 spec
+	var observed iapetosapiv1.StatefulPod
+	if err := c.Get(ctx, key, &observed); err != nil {
+		t.Fatal(err)
+	}
+	var edited iapetosapiv1.StatefulPod
+	if err := c.Get(ctx, key, &edited); err != nil {
+		t.Fatal(err)
+	}
+	newSize := int32(3)
+	edited.Spec.Size = &newSize
+	if err := c.Update(ctx, &edited); err != nil {
+		t.Fatal(err)
+	}
+
+	// 过期的对象上计算的 status 不覆盖，返回冲突
+	observed.Finalizers = []string{iapetosapiv1.GroupVersion.String()}
+	observed.Status.PodStatusMes = []iapetosapiv1.PodStatus{{PodName: "sp-0", Status: corev1.PodRunning}}
+	if _, err := NewStatefulPod(c).Update(ctx, &observed); services.ClassifyError(err) != services.ErrorConflict {
+		t.Fatalf("Update() with a stale object = %v; want conflict", err)
+	}
+	var got iapetosapiv1.StatefulPod
+	if err := c.Get(ctx, key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Status.PodStatusMes) != 0 || len(got.Finalizers) != 0 {
+		t.Fatalf("statefulPod = %+v; want unchanged after conflict", got)
+	}
+
+	// 在最新的对象上重新计算后写入，保留 spec 的修改
+	got.Finalizers = []string{iapetosapiv1.GroupVersion.String()}
+	got.Status.PodStatusMes = []iapetosapiv1.PodStatus{{PodName: "sp-0", Status: corev1.PodRunning}}
+	if _, err := NewStatefulPod(c).Update(ctx, &got); err != nil {
+		t.Fatalf("Update() = %v", err)
+	}
+	var written iapetosapiv1.StatefulPod
+	if err := c.Get(ctx, key, &written); err != nil {
+		t.Fatal(err)
+	}
+	if *written.Spec.Size != 3 {
+		t.Errorf("spec.size = %v; want the concurrent change 3 kept", *written.Spec.Size)
+	}
+	if len(written.Status.PodStatusMes) != 1 || written.Status.PodStatusMes[0].PodName != "sp-0" {
+		t.Errorf("status.podStatus = %+v; want sp-0", written.Status.PodStatusMes)
+	}
+	if len(written.Finalizers) != 1 {
+		t.Errorf("finalizers = %v; want the controller finalizer", written.Finalizers)
+	}
+	if got.ResourceVersion != written.ResourceVersion {
+		t.Errorf("resourceVersion = %v; want the written object %v", got.ResourceVersion, written.ResourceVersion)
+	}
+}
+
+// cache 落后时返回之前读取的对象
+type laggingClient struct {
+	client.Client
+	stale []*iapetosapiv1.StatefulPod
+}
+
+func (c *laggingClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if len(c.stale) > 0 {
+		c.stale[0].DeepCopyInto(obj.(*iapetosapiv1.StatefulPod))
+		c.stale = c.stale[1:]
+		return nil
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func TestUpdateWaitsForCache(t *testing.T) {
+	defer fastBackoff()()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = iapetosapiv1.AddToScheme(scheme)
+	size := int32(1)
+	c := fake.NewFakeClientWithScheme(scheme, &iapetosapiv1.StatefulPod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sp"},
+		Spec:       iapetosapiv1.StatefulPodSpec{Size: &size},
+	})
+	ctx := context.Background()
+	var statefulPod iapetosapiv1.StatefulPod
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "sp"}, &statefulPod); err != nil {
+		t.Fatal(err)
+	}
+	lagging := &laggingClient{Client: c}
+	handler := NewStatefulPod(lagging)
+
+	// 第一次写入
+	before := statefulPod.DeepCopy()
+	statefulPod.Finalizers = []string{iapetosapiv1.GroupVersion.String()}
+	if _, err := handler.Update(ctx, &statefulPod); err != nil {
+		t.Fatalf("first Update() = %v", err)
+	}
+	// 第二次写入时 cache 仍返回第一次写入之前的对象
+	lagging.stale = []*iapetosapiv1.StatefulPod{before, before}
+	statefulPod.Status.PodStatusMes = []iapetosapiv1.PodStatus{{PodName: "sp-0", Status: corev1.PodRunning}}
+	if _, err := handler.Update(ctx, &statefulPod); err != nil {
+		t.Fatalf("second Update() with a lagging cache = %v; want written after the cache catches up", err)
+	}
+	var got iapetosapiv1.StatefulPod
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "sp"}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Finalizers) != 1 || len(got.Status.PodStatusMes) != 1 {
+		t.Errorf("statefulPod = %+v; want both writes", got)
+	}
+}
+
+func fastBackoff() func() {
+	backoff := UpdateBackoff
+	UpdateBackoff = wait.Backoff{Steps: backoff.Steps, Duration: time.Millisecond}
+	return func() {
+		UpdateBackoff = backoff
+	}
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// 标记默认 StorageClass 的 annotation
+	IsDefaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+)
+
+// pvc 是否要等到 pod 调度后才会绑定，此时不能在创建 pod 之前等待 pvc 绑定
+// storageClassName 为 nil 时使用默认 StorageClass，为空字符串时绑定静态 pv
+func (r *Resource) IsWaitForFirstConsumer(ctx context.Context, storageClassName *string) bool {
+	var storageClass *storagev1.StorageClass
+	if storageClassName == nil {
+		var storageClasses storagev1.StorageClassList
+		if err := r.List(ctx, &storageClasses); err != nil {
+			r.Log.Error(err, "list storageClass error")
+			return true
+		}
+		for i := range storageClasses.Items {
+			if storageClasses.Items[i].Annotations[IsDefaultStorageClassAnnotation] == "true" {
+				storageClass = &storageClasses.Items[i]
+				break
+			}
+		}
+	} else if *storageClassName != "" {
+		var class storagev1.StorageClass
+		if err := r.Get(ctx, types.NamespacedName{Name: *storageClassName}, &class); err != nil {
+			r.Log.Error(err, "get storageClass error")
+			// 无法确认时不等待 pvc 绑定，避免 pod 与 pvc 相互等待
+			return true
+		}
+		storageClass = &class
+	}
+	if storageClass == nil || storageClass.VolumeBindingMode == nil {
+		return false
+	}
+	return *storageClass.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer
+}
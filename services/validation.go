@@ -0,0 +1,39 @@
+package services
+
+import (
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+// 校验控制器依赖的 spec 字段，不合法时返回 InvalidSpec 错误
+func ValidateStatefulPod(statefulPod *iapetosapiv1.StatefulPod) error {
+	if statefulPod.Spec.Size == nil {
+		return NewInvalidSpecError("SizeRequired", "spec.size is required")
+	}
+	if statefulPod.Spec.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(statefulPod.Spec.Selector)
+		if err != nil {
+			return NewInvalidSpecError("InvalidSelector", "spec.selector: %v", err)
+		}
+		// 成员 pod 不匹配 selector 时会被释放
+		if !selector.Matches(labels.Set(MemberLabels(statefulPod))) {
+			return NewInvalidSpecError("SelectorMismatch", "spec.selector does not match the labels of member pods %v", MemberLabels(statefulPod))
+		}
+	}
+	if policy := statefulPod.Spec.BackupPolicy; policy != nil && policy.Schedule != "" {
+		if _, err := cron.ParseStandard(policy.Schedule); err != nil {
+			return NewInvalidSpecError("InvalidBackupSchedule", "spec.backupPolicy.schedule: %v", err)
+		}
+	}
+	// pvc 名称取自第一个 volume 的 claimName
+	if statefulPod.Spec.PVCTemplate != nil {
+		volumes := statefulPod.Spec.PodTemplate.Volumes
+		if len(volumes) == 0 || volumes[0].PersistentVolumeClaim == nil {
+			return NewInvalidSpecError("PVCVolumeMissing", "spec.pvcTemplate requires the first volume of spec.podTemplate to be a persistentVolumeClaim")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+func TestValidateStatefulPod(t *testing.T) {
+	size := int32(1)
+	valid := func() *iapetosapiv1.StatefulPod {
+		return &iapetosapiv1.StatefulPod{Spec: iapetosapiv1.StatefulPodSpec{
+			Size:        &size,
+			PVCTemplate: &corev1.PersistentVolumeClaimSpec{},
+			PodTemplate: corev1.PodSpec{Volumes: []corev1.Volume{{
+				Name:         "data",
+				VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}},
+			}}},
+			BackupPolicy: &iapetosapiv1.BackupPolicy{Schedule: "0 3 * * *"},
+		}}
+	}
+	if err := ValidateStatefulPod(valid()); err != nil {
+		t.Fatalf("ValidateStatefulPod() = %v; want nil", err)
+	}
+	cases := map[string]struct {
+		mutate func(*iapetosapiv1.StatefulPod)
+		reason string
+	}{
+		"no size":        {func(sp *iapetosapiv1.StatefulPod) { sp.Spec.Size = nil }, "SizeRequired"},
+		"no pvc volume":  {func(sp *iapetosapiv1.StatefulPod) { sp.Spec.PodTemplate.Volumes = nil }, "PVCVolumeMissing"},
+		"bad schedule":   {func(sp *iapetosapiv1.StatefulPod) { sp.Spec.BackupPolicy.Schedule = "every day" }, "InvalidBackupSchedule"},
+		"not pvc volume": {func(sp *iapetosapiv1.StatefulPod) { sp.Spec.PodTemplate.Volumes[0].PersistentVolumeClaim = nil }, "PVCVolumeMissing"},
+		"selector expression": {func(sp *iapetosapiv1.StatefulPod) {
+			sp.Spec.Selector = &metav1.LabelSelector{
+				MatchLabels:      map[string]string{"app": "db"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"data"}}},
+			}
+		}, "SelectorMismatch"},
+	}
+	for name, c := range cases {
+		sp := valid()
+		c.mutate(sp)
+		err := ValidateStatefulPod(sp)
+		if ClassifyError(err) != ErrorInvalidSpec || ErrorReason(err) != c.reason {
+			t.Errorf("%s: ValidateStatefulPod() = %v; want InvalidSpec %v", name, err, c.reason)
+		}
+	}
+}
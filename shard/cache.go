@@ -0,0 +1,140 @@
+// 控制器的运行范围：只监听指定的 namespace，只处理 labels 匹配分片 selector 的 statefulPod，
+// 多个控制器实例可以据此拆分大集群，或由每个租户在自己的 namespace 中运行控制器
+package shard
+
+import (
+	"context"
+	"strings"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	"github.com/q8s-io/iapetos/services"
+)
+
+// 只缓存指定 namespace 中的对象，node、pv 等集群级别的对象仍然全量缓存；
+// namespaces 为空时返回 nil，使用 manager 默认的全量缓存
+func NewCacheFunc(namespaces []string) cache.NewCacheFunc {
+	if len(namespaces) == 0 {
+		return nil
+	}
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		namespaced, err := cache.MultiNamespacedCacheBuilder(namespaces)(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		// 判断 node 是否失联需要读取 node lease，kube-node-lease 中只缓存 lease
+		opts.Namespace = services.NodeLeaseNamespace
+		leases, err := cache.New(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.Namespace = ""
+		cluster, err := cache.New(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &scopedCache{
+			namespaced: namespaced,
+			leases:     leases,
+			cluster:    cluster,
+			scheme:     opts.Scheme,
+			mapper:     opts.Mapper,
+		}, nil
+	}
+}
+
+var leaseGroupKind = coordinationv1.SchemeGroupVersion.WithKind("Lease").GroupKind()
+
+// 按对象的 scope 分发到 namespace 缓存或集群缓存，lease 分发到 kube-node-lease 缓存
+type scopedCache struct {
+	namespaced cache.Cache
+	leases     cache.Cache
+	cluster    cache.Cache
+	scheme     *runtime.Scheme
+	mapper     meta.RESTMapper
+}
+
+func (c *scopedCache) cacheForKind(gvk schema.GroupVersionKind) (cache.Cache, error) {
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	if gvk.GroupKind() == leaseGroupKind {
+		return c.leases, nil
+	}
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return c.cluster, nil
+	}
+	return c.namespaced, nil
+}
+
+func (c *scopedCache) cacheFor(obj runtime.Object) (cache.Cache, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return nil, err
+	}
+	return c.cacheForKind(gvk)
+}
+
+func (c *scopedCache) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	cache, err := c.cacheFor(obj)
+	if err != nil {
+		return err
+	}
+	return cache.Get(ctx, key, obj)
+}
+
+func (c *scopedCache) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	cache, err := c.cacheFor(list)
+	if err != nil {
+		return err
+	}
+	return cache.List(ctx, list, opts...)
+}
+
+func (c *scopedCache) GetInformer(obj runtime.Object) (cache.Informer, error) {
+	cache, err := c.cacheFor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return cache.GetInformer(obj)
+}
+
+func (c *scopedCache) GetInformerForKind(gvk schema.GroupVersionKind) (cache.Informer, error) {
+	cache, err := c.cacheForKind(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return cache.GetInformerForKind(gvk)
+}
+
+func (c *scopedCache) IndexField(obj runtime.Object, field string, extractValue client.IndexerFunc) error {
+	cache, err := c.cacheFor(obj)
+	if err != nil {
+		return err
+	}
+	return cache.IndexField(obj, field, extractValue)
+}
+
+func (c *scopedCache) Start(stop <-chan struct{}) error {
+	caches := []cache.Cache{c.cluster, c.namespaced, c.leases}
+	errs := make(chan error, len(caches))
+	for _, scoped := range caches {
+		go func(scoped cache.Cache) {
+			errs <- scoped.Start(stop)
+		}(scoped)
+	}
+	return <-errs
+}
+
+func (c *scopedCache) WaitForCacheSync(stop <-chan struct{}) bool {
+	return c.cluster.WaitForCacheSync(stop) && c.namespaced.WaitForCacheSync(stop) && c.leases.WaitForCacheSync(stop)
+}
@@ -0,0 +1,12 @@
+package shard
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+
+	iapetosapiv1 "github.com/q8s-io/iapetos/api/v1"
+)
+
+// statefulPod 是否属于当前分片，selector 为空时处理所有 statefulPod
+func Contains(selector labels.Selector, statefulPod *iapetosapiv1.StatefulPod) bool {
+	return selector == nil || selector.Matches(labels.Set(statefulPod.Labels))
+}
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"strconv"
+	"time"
 )
 
 func StringToInt(str string) int {
@@ -32,3 +33,11 @@ func IntToIntr32(index int) *int32 {
 	v := int32(index)
 	return &v
 }
+
+// 取两个等待时间中较小的非零值，0 表示不需要等待
+func MinRequeueAfter(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}